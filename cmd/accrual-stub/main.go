@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/accrualstub"
+	"github.com/ZnNr/Go-GopherMart.git/internal/logger"
+	"net/http"
+	"os"
+	"time"
+)
+
+const logLevel = "info"
+
+func main() {
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	// Инициализируем флаги заглушки
+	addr := flag.String("a", "localhost:8081", "address and port to run accrual stub")
+	scripts := flag.String("s", "", "order scripts, e.g. 12345678903=REGISTERED;PROCESSING;PROCESSED:500,9278923470=204")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed for random order progression")
+	random := flag.Bool("random", true, "answer orders without script with random REGISTERED->PROCESSING->PROCESSED/INVALID progression")
+	rateLimit := flag.Int("rate", 0, "max requests per minute before answering 429, 0 means unlimited")
+	failureRate := flag.Float64("fail", 0, "share of requests answered with 500")
+	flag.Parse()
+	if envRunAddr := os.Getenv("RUN_ADDRESS"); envRunAddr != "" {
+		*addr = envRunAddr
+	}
+	// Разбираем сценарии для заказов
+	parsed, err := accrualstub.ParseScripts(*scripts)
+	if err != nil {
+		log.Sugar().Errorf("error while parsing order scripts: %s", err.Error())
+		os.Exit(1)
+	}
+	opts := []accrualstub.Option{
+		accrualstub.WithScripts(parsed),
+		accrualstub.WithRateLimit(*rateLimit),
+		accrualstub.WithFailureRate(*failureRate),
+	}
+	if *random {
+		opts = append(opts, accrualstub.WithRandomProgression(*seed))
+	}
+	log.Sugar().Infof("Starting accrual stub on addr: %s", *addr)
+	if err = http.ListenAndServe(*addr, accrualstub.New(opts...)); err != nil {
+		log.Sugar().Errorf("error while running accrual stub: %s", err.Error())
+		os.Exit(1)
+	}
+}
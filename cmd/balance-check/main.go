@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/database"
+	"github.com/ZnNr/Go-GopherMart.git/internal/flags"
+	"github.com/ZnNr/Go-GopherMart.git/internal/logger"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"os"
+)
+
+const logLevel = "info"
+
+// Проверка сохранённых балансов пользователей по журналу баллов; с флагом -repair расхождения исправляются.
+// Завершается с кодом 3, если найдены неисправленные расхождения.
+func main() {
+	ctx := context.Background()
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	repair := flag.Bool("repair", false, "overwrite mismatched balances with values recomputed from the ledger")
+	params := flags.Init(
+		flags.WithDatabase(),
+	)
+	// Открываем соединение с базой данных
+	db, err := sql.Open("pgx", params.Database.ConnectionString)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+	dbManager, err := database.New(ctx, db)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		os.Exit(1)
+	}
+	mismatches, err := dbManager.GetBalanceMismatches()
+	if err != nil {
+		log.Sugar().Errorf("error while checking balances: %s", err.Error())
+		os.Exit(1)
+	}
+	unrepaired := 0
+	for i := range mismatches {
+		log.Sugar().Warnf("balance of user %q mismatches ledger: stored %s/%s, actual %s/%s", mismatches[i].UserName,
+			mismatches[i].Stored.Current, mismatches[i].Stored.Withdrawn, mismatches[i].Actual.Current, mismatches[i].Actual.Withdrawn)
+		if !*repair {
+			unrepaired++
+			continue
+		}
+		// Баланс пересчитывается заново под блокировкой, поэтому исправление учитывает проводки, сделанные после проверки
+		actual, err := dbManager.RepairBalance(mismatches[i].UserName)
+		if err != nil {
+			log.Sugar().Errorf("error while repairing balance: %s", err.Error())
+			unrepaired++
+			continue
+		}
+		mismatches[i].Actual = actual
+		mismatches[i].Repaired = true
+	}
+	result, _ := json.MarshalIndent(mismatches, "", "  ")
+	fmt.Println(string(result))
+	if unrepaired > 0 {
+		os.Exit(3)
+	}
+}
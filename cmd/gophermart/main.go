@@ -6,16 +6,26 @@ import (
 	"fmt"
 	"github.com/ZnNr/Go-GopherMart.git/internal/database"
 	"github.com/ZnNr/Go-GopherMart.git/internal/flags"
+	"github.com/ZnNr/Go-GopherMart.git/internal/leader"
 	"github.com/ZnNr/Go-GopherMart.git/internal/logger"
 	"github.com/ZnNr/Go-GopherMart.git/internal/loyalty"
+	"github.com/ZnNr/Go-GopherMart.git/internal/migrations"
+	"github.com/ZnNr/Go-GopherMart.git/internal/reconcile"
 	"github.com/ZnNr/Go-GopherMart.git/internal/router"
 	runner2 "github.com/ZnNr/Go-GopherMart.git/internal/runner"
 	"github.com/ZnNr/Go-GopherMart.git/internal/server"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"os"
+	"time"
 )
 
-const logLevel = "info"
+const (
+	logLevel = "info"
+	// jobsLockKey это ключ advisory-блокировки, которой экземпляры сервиса выбирают лидера для фоновых задач.
+	jobsLockKey int64 = 0x676f706865726d61
+	// pollInterval это период опроса системы начисления.
+	pollInterval = time.Second
+)
 
 func main() {
 	ctx := context.Background()
@@ -28,7 +38,19 @@ func main() {
 	params := flags.Init(
 		flags.WithAddr(),
 		flags.WithDatabase(),
+		flags.WithMigrations(),
 		flags.WithAccrual(),
+		flags.WithAccrualWorkers(),
+		flags.WithAccrualRateLimit(),
+		flags.WithAccrualClient(),
+		flags.WithAccrualTLS(),
+		flags.WithAccrualAuth(),
+		flags.WithAccrualProviders(),
+		flags.WithAccrualBreaker(),
+		flags.WithAccrualCallback(),
+		flags.WithAccrualQuarantine(),
+		flags.WithAdminToken(),
+		flags.WithReconcile(),
 	)
 	// Открываем соединение с базой данных
 	db, err := sql.Open("pgx", params.Database.ConnectionString)
@@ -42,18 +64,69 @@ func main() {
 			os.Exit(1)
 		}
 	}()
+	// Применяем миграции схемы; экземпляры сервиса, запущенные одновременно, применяют их по очереди
+	if params.Database.Migrate {
+		migrator, err := migrations.New(db, log.Sugar())
+		if err != nil {
+			log.Sugar().Errorf("error while loading migrations: %s", err.Error())
+			os.Exit(1)
+		}
+		if _, err = migrator.Up(ctx); err != nil {
+			log.Sugar().Errorf("error while applying migrations: %s", err.Error())
+			os.Exit(1)
+		}
+	}
 	// Инициализируем менеджер базы данных
 	dbManager, err := database.New(ctx, db)
 	if err != nil {
 		log.Sugar().Errorf("error while init db: %s", err.Error())
 		os.Exit(1)
 	}
-	// Создаем экземпляр сервера приложения
-	appServer := server.New(params.Server.Address, router.SetupRouter(dbManager, log.Sugar()))
+	// Создаем клиенты систем начисления, общие для всех запросов; каждая система защищена своим автоматическим выключателем
+	accrualProviders, breakers, err := loyalty.NewProviders(params, log.Sugar())
+	if err != nil {
+		log.Sugar().Errorf("error while init accrual providers: %s", err.Error())
+		os.Exit(1)
+	}
 	// Создаем экземпляр системы начисления бонусных баллов
-	loyaltyPointsSystem := loyalty.New(params.AccrualSystem.Address, dbManager, log.Sugar())
+	loyaltyPointsSystem := loyalty.New(accrualProviders, dbManager, log.Sugar(),
+		loyalty.WithWorkers(params.AccrualSystem.Workers),
+		loyalty.WithRateLimit(params.AccrualSystem.RateLimit),
+		loyalty.WithQuarantineAfter(params.AccrualSystem.QuarantineAfter),
+	)
+	// Создаем задачу опроса системы начисления, которая перезапускается при серии ошибок
+	ordersPoller := runner2.NewSupervisor("actualize orders info", pollInterval, loyaltyPointsSystem.UpdateOrdersInfo, log.Sugar())
+	// Новые заказы опрашиваются сразу по уведомлению из базы данных, таймер остаётся запасным вариантом
+	newOrdersListener := database.NewListener(db, database.NewOrdersChannel, func(string) { ordersPoller.Trigger() }, log.Sugar())
+	jobs := []runner2.Job{ordersPoller, newOrdersListener}
+	// Создаем задачу периодической сверки начислений, если она включена; сверка обращается к системе начисления
+	// через менеджер системы лояльности и соблюдает общие с опросом ограничение частоты и паузы
+	if params.Reconcile.Interval > 0 {
+		reconciler := reconcile.New(loyaltyPointsSystem, dbManager, log.Sugar(),
+			reconcile.WithApply(params.Reconcile.Apply),
+			reconcile.WithWindow(params.Reconcile.Window),
+		)
+		jobs = append(jobs, runner2.NewSupervisor("reconcile accruals", params.Reconcile.Interval, reconciler.Pass, log.Sugar()))
+	}
+	// Создаем механизм выбора лидера, на котором будут выполняться фоновые задачи
+	elector := leader.New(db, jobsLockKey, log.Sugar())
+	// Создаем экземпляр сервера приложения
+	appServer := server.New(params.Server.Address, router.SetupRouter(dbManager, log.Sugar(),
+		router.WithStatus("leader", func() any { return elector.IsLeader() }),
+		router.WithStatus("orders_poller", func() any { return ordersPoller.Status() }),
+		router.WithStatus("accrual_circuit_breakers", func() any {
+			statuses := make(map[string]loyalty.BreakerStatus, len(breakers))
+			for name, breaker := range breakers {
+				statuses[name] = breaker.Status()
+			}
+			return statuses
+		}),
+		router.WithStatus("accrual_response_violations", func() any { return loyaltyPointsSystem.Violations() }),
+		router.WithAccrualCallback([]byte(params.AccrualSystem.CallbackSecret)),
+		router.WithAdmin([]byte(params.Server.AdminToken)),
+	))
 	// Создаем экземпляр runner и запускаем приложение
-	runner := runner2.New(appServer, loyaltyPointsSystem, log.Sugar())
+	runner := runner2.New(appServer, elector, log.Sugar(), jobs...)
 	if err = runner.Run(ctx); err != nil {
 		log.Sugar().Errorf("error while running runner: %s", err.Error())
 		return
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/flags"
+	"github.com/ZnNr/Go-GopherMart.git/internal/logger"
+	"github.com/ZnNr/Go-GopherMart.git/internal/migrations"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"os"
+	"strconv"
+)
+
+const logLevel = "info"
+
+// Управление миграциями схемы базы данных: migrate [-d connection] up | down [steps] | status.
+func main() {
+	ctx := context.Background()
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	params := flags.Init(
+		flags.WithDatabase(),
+	)
+	command := flag.Arg(0)
+	steps := 1
+	if command == "down" && flag.NArg() > 1 {
+		if steps, err = strconv.Atoi(flag.Arg(1)); err != nil || steps <= 0 {
+			log.Sugar().Errorf("error while parsing steps: must be a positive number")
+			os.Exit(1)
+		}
+	}
+	// Открываем соединение с базой данных
+	db, err := sql.Open("pgx", params.Database.ConnectionString)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+	migrator, err := migrations.New(db, log.Sugar())
+	if err != nil {
+		log.Sugar().Errorf("error while loading migrations: %s", err.Error())
+		os.Exit(1)
+	}
+	switch command {
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			log.Sugar().Errorf("error while applying migrations: %s", err.Error())
+			os.Exit(1)
+		}
+		log.Sugar().Infof("applied %d migrations", count)
+	case "down":
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Sugar().Errorf("error while reverting migrations: %s", err.Error())
+			os.Exit(1)
+		}
+		log.Sugar().Infof("reverted %d migrations", count)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Sugar().Errorf("error while getting migrations status: %s", err.Error())
+			os.Exit(1)
+		}
+		result, _ := json.MarshalIndent(statuses, "", "  ")
+		fmt.Println(string(result))
+	default:
+		fmt.Println("usage: migrate [-d connection] up | down [steps] | status")
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/database"
+	"github.com/ZnNr/Go-GopherMart.git/internal/flags"
+	"github.com/ZnNr/Go-GopherMart.git/internal/logger"
+	"github.com/ZnNr/Go-GopherMart.git/internal/loyalty"
+	"github.com/ZnNr/Go-GopherMart.git/internal/reconcile"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"os"
+	"time"
+)
+
+const (
+	logLevel   = "info"
+	dateLayout = "2006-01-02"
+)
+
+// Разовая сверка начислений по обработанным заказам, загруженным в интервале [from, to).
+func main() {
+	ctx := context.Background()
+	log, err := logger.New(logLevel)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	// Инициализируем флаги сверки
+	today := time.Now().Format(dateLayout)
+	from := flag.String("from", today, "reconcile orders uploaded since this date, YYYY-MM-DD")
+	to := flag.String("to", today, "reconcile orders uploaded up to this date inclusive, YYYY-MM-DD")
+	apply := flag.Bool("apply", false, "adjust accruals of found discrepancies")
+	params := flags.Init(
+		flags.WithDatabase(),
+		flags.WithAccrual(),
+		flags.WithAccrualRateLimit(),
+		flags.WithAccrualClient(),
+		flags.WithAccrualTLS(),
+		flags.WithAccrualAuth(),
+		flags.WithAccrualProviders(),
+		flags.WithAccrualBreaker(),
+	)
+	fromDate, err := time.ParseInLocation(dateLayout, *from, time.Local)
+	if err != nil {
+		log.Sugar().Errorf("error while parsing from date: %s", err.Error())
+		os.Exit(1)
+	}
+	toDate, err := time.ParseInLocation(dateLayout, *to, time.Local)
+	if err != nil {
+		log.Sugar().Errorf("error while parsing to date: %s", err.Error())
+		os.Exit(1)
+	}
+	// Открываем соединение с базой данных
+	db, err := sql.Open("pgx", params.Database.ConnectionString)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		os.Exit(1)
+	}
+	defer db.Close()
+	dbManager, err := database.New(ctx, db)
+	if err != nil {
+		log.Sugar().Errorf("error while init db: %s", err.Error())
+		os.Exit(1)
+	}
+	// Создаем клиенты систем начисления так же, как сервис: с системами партнёров и автоматическими выключателями
+	accrualProviders, _, err := loyalty.NewProviders(params, log.Sugar())
+	if err != nil {
+		log.Sugar().Errorf("error while init accrual providers: %s", err.Error())
+		os.Exit(1)
+	}
+	// Запросы сверки соблюдают ограничение частоты и паузы системы начисления так же, как опрос заказов
+	loyaltyPointsSystem := loyalty.New(accrualProviders, dbManager, log.Sugar(),
+		loyalty.WithRateLimit(params.AccrualSystem.RateLimit),
+	)
+	reconciler := reconcile.New(loyaltyPointsSystem, dbManager, log.Sugar(),
+		reconcile.WithApply(*apply),
+	)
+	report, err := reconciler.Reconcile(ctx, fromDate, toDate.AddDate(0, 0, 1))
+	if report != nil {
+		result, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(result))
+	}
+	if err != nil {
+		log.Sugar().Errorf("error while reconciling accruals: %s", err.Error())
+		os.Exit(1)
+	}
+}
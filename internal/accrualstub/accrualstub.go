@@ -0,0 +1,288 @@
+package accrualstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Статусы расчёта начисления из SPECIFICATION.md.
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Step описывает один ответ заглушки на запрос о заказе.
+type Step struct {
+	Code       int           // Code это HTTP-код ответа.
+	Status     string        // Status это статус расчёта начисления для ответа 200.
+	Accrual    *float64      // Accrual это рассчитанные баллы; nil — поле отсутствует в ответе.
+	RetryAfter time.Duration // RetryAfter это значение заголовка Retry-After для ответа 429.
+}
+
+// Registered возвращает ответ со статусом REGISTERED.
+func Registered() Step {
+	return Step{Code: http.StatusOK, Status: StatusRegistered}
+}
+
+// Processing возвращает ответ со статусом PROCESSING.
+func Processing() Step {
+	return Step{Code: http.StatusOK, Status: StatusProcessing}
+}
+
+// Processed возвращает ответ со статусом PROCESSED и начислением accrual.
+func Processed(accrual float64) Step {
+	return Step{Code: http.StatusOK, Status: StatusProcessed, Accrual: &accrual}
+}
+
+// Invalid возвращает ответ со статусом INVALID.
+func Invalid() Step {
+	return Step{Code: http.StatusOK, Status: StatusInvalid}
+}
+
+// NotRegistered возвращает ответ 204: заказ не зарегистрирован в системе расчёта.
+func NotRegistered() Step {
+	return Step{Code: http.StatusNoContent}
+}
+
+// ServerError возвращает ответ 500.
+func ServerError() Step {
+	return Step{Code: http.StatusInternalServerError}
+}
+
+// TooManyRequests возвращает ответ 429 с заголовком Retry-After.
+func TooManyRequests(retryAfter time.Duration) Step {
+	return Step{Code: http.StatusTooManyRequests, RetryAfter: retryAfter}
+}
+
+// Script задаёт последовательность ответов для заказа number. Каждый запрос получает следующий шаг,
+// последний шаг повторяется бесконечно; без шагов заказ остаётся незарегистрированным.
+func (s *Server) Script(number string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[number] = append([]Step(nil), steps...)
+}
+
+// Requests возвращает количество запросов о заказе number.
+func (s *Server) Requests(number string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[number]
+}
+
+// ServeHTTP обрабатывает запросы GET /api/orders/{number}.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// getOrderHandler отвечает на запрос о заказе в соответствии со сценарием.
+func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	number := chi.URLParam(r, "number")
+	step := s.next(number)
+	switch step.Code {
+	case http.StatusOK:
+		w.Header().Set("Content-Type", "application/json")
+		body, err := json.Marshal(response{Order: number, Status: step.Status, Accrual: step.Accrual})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	case http.StatusTooManyRequests:
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(step.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(w, "No more than %d requests per minute allowed", s.rateLimit)
+	default:
+		w.WriteHeader(step.Code)
+	}
+}
+
+// next определяет ответ на очередной запрос о заказе number.
+func (s *Server) next(number string) Step {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[number]++
+	// Ограничение частоты запросов действует для всех заказов
+	if s.rateLimit > 0 {
+		now := time.Now()
+		if now.Sub(s.windowStart) >= time.Minute {
+			s.windowStart = now
+			s.windowRequests = 0
+		}
+		s.windowRequests++
+		if s.windowRequests > s.rateLimit {
+			return TooManyRequests(time.Minute - now.Sub(s.windowStart))
+		}
+	}
+	if s.failureRate > 0 && s.rnd.Float64() < s.failureRate {
+		return ServerError()
+	}
+	steps, ok := s.scripts[number]
+	if !ok {
+		if !s.progression {
+			return NotRegistered()
+		}
+		steps = s.randomProgression()
+		s.scripts[number] = steps
+	}
+	// Пустой сценарий, заданный через Script или WithScripts, означает незарегистрированный заказ
+	if len(steps) == 0 {
+		return NotRegistered()
+	}
+	step := steps[0]
+	if len(steps) > 1 {
+		s.scripts[number] = steps[1:]
+	}
+	return step
+}
+
+// randomProgression генерирует сценарий REGISTERED→PROCESSING→PROCESSED/INVALID со случайным количеством шагов.
+func (s *Server) randomProgression() []Step {
+	steps := []Step{Registered()}
+	for i := s.rnd.Intn(3); i >= 0; i-- {
+		steps = append(steps, Processing())
+	}
+	if s.rnd.Intn(5) == 0 {
+		return append(steps, Invalid())
+	}
+	return append(steps, Processed(float64(s.rnd.Intn(100000))/100))
+}
+
+// ParseScripts разбирает сценарии из строки вида "number=STEP[;STEP...][,number=...]", где STEP — это
+// REGISTERED, PROCESSING, INVALID, PROCESSED:<accrual>, 204, 500 или 429:<seconds>.
+func ParseScripts(spec string) (map[string][]Step, error) {
+	scripts := make(map[string][]Step)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		number, stepsSpec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid script entry %q: expected number=steps", entry)
+		}
+		var steps []Step
+		for _, stepSpec := range strings.Split(stepsSpec, ";") {
+			step, err := parseStep(strings.TrimSpace(stepSpec))
+			if err != nil {
+				return nil, fmt.Errorf("invalid script for order %q: %w", number, err)
+			}
+			steps = append(steps, step)
+		}
+		scripts[strings.TrimSpace(number)] = steps
+	}
+	return scripts, nil
+}
+
+// parseStep разбирает один шаг сценария.
+func parseStep(spec string) (Step, error) {
+	name, arg, _ := strings.Cut(spec, ":")
+	switch strings.ToUpper(name) {
+	case StatusRegistered:
+		return Registered(), nil
+	case StatusProcessing:
+		return Processing(), nil
+	case StatusInvalid:
+		return Invalid(), nil
+	case StatusProcessed:
+		accrual, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return Step{}, fmt.Errorf("invalid accrual %q: %w", arg, err)
+		}
+		return Processed(accrual), nil
+	case "204":
+		return NotRegistered(), nil
+	case "500":
+		return ServerError(), nil
+	case "429":
+		seconds, err := strconv.Atoi(arg)
+		if err != nil {
+			return Step{}, fmt.Errorf("invalid retry after %q: %w", arg, err)
+		}
+		return TooManyRequests(time.Duration(seconds) * time.Second), nil
+	default:
+		return Step{}, fmt.Errorf("unknown step %q", spec)
+	}
+}
+
+// Option определяет функцию для настройки заглушки.
+type Option func(s *Server)
+
+// WithRandomProgression включает случайный сценарий REGISTERED→PROCESSING→PROCESSED/INVALID для заказов
+// без заданного сценария; без этой опции такие заказы получают ответ 204.
+func WithRandomProgression(seed int64) Option {
+	return func(s *Server) {
+		s.progression = true
+		s.rnd = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithRateLimit ограничивает количество запросов в минуту; сверх лимита заглушка отвечает 429 с Retry-After.
+func WithRateLimit(requestsPerMinute int) Option {
+	return func(s *Server) {
+		s.rateLimit = requestsPerMinute
+	}
+}
+
+// WithFailureRate задаёт долю запросов, на которые заглушка отвечает 500.
+func WithFailureRate(rate float64) Option {
+	return func(s *Server) {
+		s.failureRate = rate
+	}
+}
+
+// WithScripts задаёт сценарии ответов для заказов.
+func WithScripts(scripts map[string][]Step) Option {
+	return func(s *Server) {
+		for number, steps := range scripts {
+			s.scripts[number] = steps
+		}
+	}
+}
+
+// New создает заглушку системы расчёта начислений, которую можно запустить через httptest.NewServer.
+func New(opts ...Option) *Server {
+	s := &Server{
+		scripts:     make(map[string][]Step),
+		requests:    make(map[string]int),
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		windowStart: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.router = chi.NewRouter()
+	s.router.Get("/api/orders/{number}", s.getOrderHandler)
+	return s
+}
+
+// Server реализует GET /api/orders/{number} системы расчёта начислений со сценарным поведением.
+type Server struct {
+	router         *chi.Mux
+	mu             sync.Mutex
+	scripts        map[string][]Step
+	requests       map[string]int
+	rnd            *rand.Rand
+	progression    bool
+	failureRate    float64
+	rateLimit      int
+	windowStart    time.Time
+	windowRequests int
+}
+
+// response представляет тело ответа системы расчёта начислений.
+type response struct {
+	Order   string   `json:"order"`
+	Status  string   `json:"status"`
+	Accrual *float64 `json:"accrual,omitempty"`
+}
@@ -0,0 +1,102 @@
+package accrualstub
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	t.Run("scripted order", func(t *testing.T) {
+		stub := New()
+		stub.Script("100500", Registered(), ServerError(), TooManyRequests(30*time.Second), Processed(500))
+		srv := httptest.NewServer(stub)
+		defer srv.Close()
+
+		url := fmt.Sprintf("%s/api/orders/100500", srv.URL)
+		response, err := resty.New().R().Get(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode())
+		assert.JSONEq(t, `{"order":"100500","status":"REGISTERED"}`, string(response.Body()))
+
+		response, err = resty.New().R().Get(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, response.StatusCode())
+
+		response, err = resty.New().R().Get(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, response.StatusCode())
+		assert.Equal(t, "30", response.Header().Get("Retry-After"))
+
+		for i := 0; i < 2; i++ {
+			response, err = resty.New().R().Get(url)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, response.StatusCode())
+			assert.JSONEq(t, `{"order":"100500","status":"PROCESSED","accrual":500}`, string(response.Body()))
+		}
+		assert.Equal(t, 5, stub.Requests("100500"))
+	})
+	t.Run("unknown order without progression", func(t *testing.T) {
+		srv := httptest.NewServer(New())
+		defer srv.Close()
+
+		response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode())
+	})
+	t.Run("random progression reaches final status", func(t *testing.T) {
+		srv := httptest.NewServer(New(WithRandomProgression(1)))
+		defer srv.Close()
+
+		var info response
+		for i := 0; i < 10 && info.Status != StatusProcessed && info.Status != StatusInvalid; i++ {
+			_, err := resty.New().R().SetResult(&info).Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+			assert.NoError(t, err)
+		}
+		assert.Contains(t, []string{StatusProcessed, StatusInvalid}, info.Status)
+	})
+	t.Run("rate limit", func(t *testing.T) {
+		stub := New(WithRateLimit(2))
+		stub.Script("100500", Invalid())
+		srv := httptest.NewServer(stub)
+		defer srv.Close()
+
+		codes := make([]int, 0, 3)
+		for i := 0; i < 3; i++ {
+			response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/100500", srv.URL))
+			assert.NoError(t, err)
+			codes = append(codes, response.StatusCode())
+		}
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+	})
+}
+
+func TestServer_EmptyScript(t *testing.T) {
+	stub := New(WithScripts(map[string][]Step{"100501": nil}))
+	stub.Script("100500")
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	for _, number := range []string{"100500", "100501"} {
+		response, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/%s", srv.URL, number))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, response.StatusCode())
+	}
+}
+
+func TestParseScripts(t *testing.T) {
+	t.Run("positive", func(t *testing.T) {
+		scripts, err := ParseScripts("100500=REGISTERED;PROCESSED:12.5, 100501=204;500;429:60")
+		assert.NoError(t, err)
+		assert.Equal(t, []Step{Registered(), Processed(12.5)}, scripts["100500"])
+		assert.Equal(t, []Step{NotRegistered(), ServerError(), TooManyRequests(time.Minute)}, scripts["100501"])
+	})
+	t.Run("negative: unknown step", func(t *testing.T) {
+		_, err := ParseScripts("100500=DONE")
+		assert.EqualError(t, err, `invalid script for order "100500": unknown step "DONE"`)
+	})
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+)
+
+// GetBalanceMismatches пересчитывает балансы всех пользователей по журналу баллов и возвращает те,
+// что расходятся с таблицей balances, включая пользователей без строки в ней.
+func (m *Manager) GetBalanceMismatches() ([]models.BalanceMismatch, error) {
+	rows, err := m.db.Query(selectBalanceMismatchesQuery, userAccountPrefix, ledgerKindWithdrawal)
+	if err != nil {
+		return nil, fmt.Errorf("error while checking balances: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+	mismatches := make([]models.BalanceMismatch, 0)
+	for rows.Next() {
+		var mismatch models.BalanceMismatch
+		if err = rows.Scan(&mismatch.UserName, &mismatch.Stored.Current, &mismatch.Stored.Withdrawn, &mismatch.Actual.Current, &mismatch.Actual.Withdrawn); err != nil {
+			return nil, fmt.Errorf("error while scanning balance mismatch: %w", err)
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while checking balances: %w", err)
+	}
+	return mismatches, nil
+}
+
+// RepairBalance пересчитывает баланс пользователя по журналу баллов и сохраняет его в таблицу balances.
+// Строка баланса блокируется до пересчёта, поэтому параллельные проводки применяются к уже исправленному балансу.
+func (m *Manager) RepairBalance(login string) (models.BalanceInfo, error) {
+	var info models.BalanceInfo
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return info, fmt.Errorf("error while starting balance repair transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err = tx.Exec(`insert into balances (login) values ($1) on conflict (login) do nothing`, login); err != nil {
+		return info, fmt.Errorf("error while creating balance of user %q: %w", login, err)
+	}
+	if _, err = tx.Exec(`select 1 from balances where login = $1 for update`, login); err != nil {
+		return info, fmt.Errorf("error while locking balance of user %q: %w", login, err)
+	}
+	computeBalanceQuery := `select coalesce(sum(e.amount), 0), coalesce(-sum(e.amount) filter (where t.kind = $2), 0)
+		from ledger_entries e join ledger_transactions t on t.id = e.transaction_id where e.account = $1`
+	if err = tx.QueryRow(computeBalanceQuery, userAccount(login), ledgerKindWithdrawal).Scan(&info.Current, &info.Withdrawn); err != nil {
+		return info, fmt.Errorf("error while computing balance of user %q: %w", login, err)
+	}
+	repairBalanceQuery := `update balances set current = $2, withdrawn = $3, updated_at = now() where login = $1`
+	if _, err = tx.Exec(repairBalanceQuery, login, info.Current, info.Withdrawn); err != nil {
+		return info, fmt.Errorf("error while repairing balance of user %q: %w", login, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return info, fmt.Errorf("error while committing balance repair of user %q: %w", login, err)
+	}
+	return info, nil
+}
+
+// selectBalanceMismatchesQuery сравнивает таблицу balances с балансами, пересчитанными по счетам пользователей в журнале.
+const selectBalanceMismatchesQuery = `with actual as (
+		select substr(e.account, length($1) + 1) as login, sum(e.amount) as current,
+			coalesce(-sum(e.amount) filter (where t.kind = $2), 0) as withdrawn
+		from ledger_entries e join ledger_transactions t on t.id = e.transaction_id
+		where starts_with(e.account, $1) group by e.account)
+	select coalesce(a.login, b.login), coalesce(b.current, 0), coalesce(b.withdrawn, 0), coalesce(a.current, 0), coalesce(a.withdrawn, 0)
+	from actual a full join balances b on b.login = a.login
+	where coalesce(b.current, 0) <> coalesce(a.current, 0) or coalesce(b.withdrawn, 0) <> coalesce(a.withdrawn, 0)
+	order by 1`
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestManager_GetBalanceMismatches(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(selectBalanceMismatchesQuery)).WithArgs(userAccountPrefix, ledgerKindWithdrawal).
+		WillReturnRows(sqlmock.NewRows([]string{"login", "stored_current", "stored_withdrawn", "actual_current", "actual_withdrawn"}).
+			AddRow("test-login", "100.00", "0", "90.00", "10.00"))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	mismatches, err := manager.GetBalanceMismatches()
+	assert.NoError(t, err)
+	assert.Equal(t, []models.BalanceMismatch{{
+		UserName: "test-login",
+		Stored:   models.BalanceInfo{Current: 10000},
+		Actual:   models.BalanceInfo{Current: 9000, Withdrawn: 1000},
+	}}, mismatches)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_RepairBalance(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`insert into balances (login) values ($1) on conflict (login) do nothing`)).WithArgs("test-login").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`select 1 from balances where login = $1 for update`)).WithArgs("test-login").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(sum(e.amount), 0), coalesce(-sum(e.amount) filter (where t.kind = $2), 0)`)).
+		WithArgs("user:test-login", ledgerKindWithdrawal).
+		WillReturnRows(sqlmock.NewRows([]string{"current", "withdrawn"}).AddRow("90.00", "10.00"))
+	mock.ExpectExec(regexp.QuoteMeta(`update balances set current = $2, withdrawn = $3, updated_at = now() where login = $1`)).
+		WithArgs("test-login", models.Money(9000), models.Money(1000)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	info, err := manager.RepairBalance("test-login")
+	assert.NoError(t, err)
+	assert.Equal(t, models.BalanceInfo{Current: 9000, Withdrawn: 1000}, info)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -7,35 +7,21 @@ import (
 	"errors"
 	"fmt"
 	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/migrations"
 	"github.com/ZnNr/Go-GopherMart.git/internal/models"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"time"
 )
 
 // GetBalanceInfo возвращает информацию о балансе пользователя и сумме снятых средств.
+// Баланс читается из таблицы balances, которая обновляется вместе с каждой проводкой журнала баллов.
 func (m *Manager) GetBalanceInfo(login string) ([]byte, error) {
-	// Получение текущего баланса пользователя
-	userBalance, err := m.getUserBalance(login)
-	if err != nil {
-		return nil, fmt.Errorf("error while getting curent user balance: %w", err)
-	}
-	// Получение суммы снятых средств у пользователя
-	getUserWithdrawn := "select sum(amount) as withdrawn from withdraw where login = $1"
-	row := m.db.QueryRow(getUserWithdrawn, login)
-	var userWithdrawn sql.NullFloat64
-	if err = row.Scan(&userWithdrawn); err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("error while getting user withdrawn info: %w", err)
-		}
-		userWithdrawn = sql.NullFloat64{
-			Float64: 0,
-			Valid:   true,
-		}
-	}
-	// Формирование структуры с информацией о балансе пользователя и сумме снятых средств
-	info := models.BalanceInfo{
-		Withdrawn: userWithdrawn.Float64,
-		Current:   userBalance,
+	getUserBalanceInfoQuery := `select current, withdrawn from balances where login = $1`
+	var info models.BalanceInfo
+	row := m.db.QueryRow(getUserBalanceInfoQuery, login)
+	if err := row.Scan(&info.Current, &info.Withdrawn); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error while getting user balance info: %w", err)
 	}
 	// Преобразование структуры в JSON
 	result, err := json.Marshal(info)
@@ -60,7 +46,7 @@ func (m *Manager) GetWithdrawals(login string) ([]byte, error) {
 	for rows.Next() {
 		var (
 			orderID     string
-			amount      float64
+			amount      models.Money
 			processedAt time.Time
 		)
 		if err = rows.Scan(&orderID, &amount, &processedAt); err != nil {
@@ -83,8 +69,29 @@ func (m *Manager) GetWithdrawals(login string) ([]byte, error) {
 }
 
 // Withdraw осуществляет снятие средств со счета пользователя.
-func (m *Manager) Withdraw(login string, orderID string, sum float64) error {
-	userBalance, err := m.getUserBalance(login)
+// Проверка баланса и списание выполняются в одной транзакции под блокировкой строки пользователя,
+// поэтому параллельные списания одного пользователя выполняются по очереди и не уводят баланс в минус.
+// Неположительная сумма отклоняется с ошибкой ErrInvalidAmount.
+func (m *Manager) Withdraw(login string, orderID string, sum models.Money) error {
+	if sum <= 0 {
+		return errors2.ErrInvalidAmount
+	}
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error while starting withdraw transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// Блокируем пользователя до конца транзакции
+	lockUserQuery := `select login from registered_users where login = $1 for update`
+	if err = tx.QueryRow(lockUserQuery, login).Scan(&login); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors2.ErrNoSuchUser
+		}
+		return fmt.Errorf("error while locking user balance: %w", err)
+	}
+	userBalance, err := getUserBalance(tx, login)
 	if err != nil {
 		return fmt.Errorf("error while checking user balance: %w", err)
 	}
@@ -92,9 +99,15 @@ func (m *Manager) Withdraw(login string, orderID string, sum float64) error {
 		return errors2.ErrInsufficientBalance
 	}
 	withdraw := "insert into withdraw values ($1, $2, now(), $3)"
-	if _, err = m.db.Exec(withdraw, login, orderID, sum); err != nil {
+	if _, err = tx.Exec(withdraw, login, orderID, sum); err != nil {
 		return fmt.Errorf("error while trying to withdraw: %w", err)
 	}
+	if err = post(tx, ledgerKindWithdrawal, orderID, userAccount(login), accountWithdrawals, sum); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing withdraw: %w", err)
+	}
 	return nil
 }
 
@@ -117,7 +130,7 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 		var (
 			orderID    string
 			status     models.OrderStatus
-			accrual    sql.NullFloat64
+			accrual    models.Money
 			uploadedAt time.Time
 		)
 		// Сканируем строки и извлекаем значения в переменные.
@@ -127,7 +140,7 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 		// Добавляем информацию о заказе в слайс.
 		userOrders = append(userOrders, models.OrderInfo{
 			OrderID:   orderID,
-			Accrual:   accrual.Float64,
+			Accrual:   accrual,
 			CreatedAt: &uploadedAt,
 			Status:    status,
 		})
@@ -142,12 +155,56 @@ func (m *Manager) GetUserOrders(login string) ([]byte, error) {
 	return result, nil
 }
 
-// GetAllOrders получает все заказы.
-func (m *Manager) GetAllOrders() ([]string, error) {
-	getAllOrdersQuery := `select order_id from orders`
-	rows, err := m.db.Query(getAllOrdersQuery)
+// GetOrderHistory получает историю статусов заказа пользователя в порядке их смены.
+// Если заказа нет или он принадлежит другому пользователю, возвращается ErrNoData.
+func (m *Manager) GetOrderHistory(login string, orderID string) ([]byte, error) {
+	getOrderHistoryQuery := `select h.status, coalesce(h.accrual, 0), h.changed_at from order_status_history h
+		join orders o on o.order_id = h.order_id
+		where h.order_id = $1 and o.login = $2
+		order by h.changed_at, h.id`
+	rows, err := m.db.Query(getOrderHistoryQuery, orderID, login)
 	if err != nil {
-		return nil, fmt.Errorf("error while getting all orders from db: %w", err)
+		return nil, fmt.Errorf("error while getting history of order %q from db: %w", orderID, err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+	// Слайс для хранения истории статусов заказа.
+	history := make([]models.OrderStatusChange, 0)
+	for rows.Next() {
+		var change models.OrderStatusChange
+		if err = rows.Scan(&change.Status, &change.Accrual, &change.ChangedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning rows: %w", err)
+		}
+		history = append(history, change)
+	}
+	if len(history) == 0 {
+		return nil, errors2.ErrNoData
+	}
+	result, err := json.Marshal(history)
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling order history: %w", err)
+	}
+	return result, nil
+}
+
+// ClaimDueOrders захватывает не более limit незавершённых заказов вне карантина, время опроса которых наступило, и сдвигает их
+// следующий опрос на время аренды lease. Строки, захваченные другими экземплярами сервиса, пропускаются,
+// поэтому несколько экземпляров делят опрос между собой без дублирования запросов к системе начисления.
+func (m *Manager) ClaimDueOrders(limit int, lease time.Duration) ([]string, error) {
+	claimDueOrdersQuery := `update orders set next_poll_at = now() + make_interval(secs => $2)
+		where order_id in (
+			select order_id from orders
+			where status in ('NEW', 'PROCESSING') and next_poll_at <= now() and quarantined_at is null
+			order by next_poll_at
+			limit $1
+			for update skip locked
+		)
+		returning order_id`
+	rows, err := m.db.Query(claimDueOrdersQuery, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error while claiming due orders from db: %w", err)
 	}
 	defer func() {
 		_ = rows.Close()
@@ -165,13 +222,97 @@ func (m *Manager) GetAllOrders() ([]string, error) {
 	return orders, nil
 }
 
-// UpdateOrderInfo обновляет информацию о заказе.
+// ScheduleNextPoll откладывает следующий опрос заказа с экспоненциально растущей задержкой, ограниченной pollBackoffMax.
+// Опрос без ошибки сбрасывает счётчик ошибок заказа. Если во время опроса пришёл обратный вызов системы начисления,
+// следующий опрос не наступает раньше, чем через callbackPollDelay после него.
+func (m *Manager) ScheduleNextPoll(orderID string) error {
+	scheduleNextPollQuery := `update orders set poll_failures = 0, poll_attempts = poll_attempts + 1, last_polled_at = now(), next_poll_at = greatest(now() + make_interval(secs => least($2 * power(2, least(poll_attempts, $4)), $3)), callback_at + make_interval(secs => $5))
+		where order_id = $1`
+	if _, err := m.db.Exec(scheduleNextPollQuery, orderID, pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), pollBackoffMaxExponent, callbackPollDelay.Seconds()); err != nil {
+		return fmt.Errorf("error while scheduling next poll for order %q: %w", orderID, err)
+	}
+	return nil
+}
+
+// UpdateOrderInfo обновляет информацию о заказе. Обновление выполняется только если переход из текущего статуса
+// заказа в новый допустим, иначе возвращается ErrForbiddenTransition.
 func (m *Manager) UpdateOrderInfo(orderInfo *models.OrderInfo) error {
-	// Запрос на обновление информации о заказе в базе данных.
-	updateOrderInfoQuery := `update orders set status=$1, accrual=$2 where order_id=$3`
-	if _, err := m.db.Exec(updateOrderInfoQuery, string(orderInfo.Status), orderInfo.Accrual, orderInfo.Order); err != nil {
+	return m.updateOrderStatus(orderInfo, false)
+}
+
+// ApplyCallback применяет информацию о заказе, присланную системой начисления, по тем же правилам переходов статусов,
+// что и UpdateOrderInfo. Следующий опрос такого заказа откладывается: он нужен, только если обратный вызов не придёт.
+func (m *Manager) ApplyCallback(orderInfo *models.OrderInfo) error {
+	return m.updateOrderStatus(orderInfo, true)
+}
+
+// updateOrderStatus обновляет статус и начисление заказа, если его текущий статус допускает переход, и записывает
+// смену статуса в историю заказа; callback отмечает, что информация получена обратным вызовом системы начисления.
+func (m *Manager) updateOrderStatus(orderInfo *models.OrderInfo, callback bool) error {
+	sources := models.TransitionSources(orderInfo.Status)
+	if len(sources) == 0 {
+		return fmt.Errorf("%w: order %q to %s", errors2.ErrForbiddenTransition, *orderInfo.Order, orderInfo.Status)
+	}
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("error while starting order update transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// Блокируем заказ и запоминаем его текущий статус, чтобы записать в историю только его смену.
+	var (
+		previous models.OrderStatus
+		login    string
+	)
+	err = tx.QueryRow(`select status, login from orders where order_id = $1 for update`, orderInfo.Order).Scan(&previous, &login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: unknown order %q", errors2.ErrForbiddenTransition, *orderInfo.Order)
+	}
+	if err != nil {
+		return fmt.Errorf("error while getting order status: %w", err)
+	}
+	// Запрос на обновление информации о заказе в базе данных, если его текущий статус допускает переход.
+	args := []any{string(orderInfo.Status), orderInfo.Accrual, orderInfo.Order}
+	set := `status=$1, accrual=$2`
+	source := historySourcePoll
+	if callback {
+		source = historySourceCallback
+		args = append(args, callbackPollDelay.Seconds())
+		set += fmt.Sprintf(`, callback_at=now(), next_poll_at=now() + make_interval(secs => $%d)`, len(args))
+	}
+	placeholders := make([]string, 0, len(sources))
+	for _, source := range sources {
+		args = append(args, string(source))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	updateOrderInfoQuery := fmt.Sprintf(`update orders set %s where order_id=$3 and status in (%s)`, set, strings.Join(placeholders, ", "))
+	result, err := tx.Exec(updateOrderInfoQuery, args...)
+	if err != nil {
 		return fmt.Errorf("error while updating order info: %w", err)
 	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while getting updated orders count: %w", err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: order %q to %s", errors2.ErrForbiddenTransition, *orderInfo.Order, orderInfo.Status)
+	}
+	if previous != orderInfo.Status {
+		insertHistoryQuery := `insert into order_status_history (order_id, status, accrual, source) values ($1, $2, $3, $4)`
+		if _, err = tx.Exec(insertHistoryQuery, orderInfo.Order, string(orderInfo.Status), orderInfo.Accrual, source); err != nil {
+			return fmt.Errorf("error while recording order status history: %w", err)
+		}
+	}
+	// Начисление по обработанному заказу проводится по журналу баллов один раз: PROCESSED окончательный статус.
+	if previous != orderInfo.Status && orderInfo.Status == models.OrderStatusProcessed && orderInfo.Accrual != 0 {
+		if err = post(tx, ledgerKindAccrual, *orderInfo.Order, accountAccruals, userAccount(login), orderInfo.Accrual); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error while committing order update: %w", err)
+	}
 	return nil
 }
 
@@ -185,9 +326,11 @@ func (m *Manager) LoadOrder(login string, orderID string) error {
 	err := row.Scan(&userName)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
-		// Если заказ не существует, создаем новый заказ.
-		loadOrderQuery := `insert into orders values ($1, $2, now(), $3, $4)`
-		if _, err = m.db.Exec(loadOrderQuery, orderID, login, models.OrderStatus("NEW"), 0); err != nil {
+		// Если заказ не существует, создаем новый заказ, начинаем его историю и в том же запросе уведомляем опрашивающий экземпляр.
+		loadOrderQuery := `with inserted as (insert into orders values ($1, $2, now(), $3, $4) returning order_id, status, accrual),
+			history as (insert into order_status_history (order_id, status, accrual, source) select order_id, status, accrual, $6 from inserted)
+			select pg_notify($5, order_id) from inserted`
+		if _, err = m.db.Exec(loadOrderQuery, orderID, login, models.OrderStatusNew, 0, NewOrdersChannel, historySourceUpload); err != nil {
 			return fmt.Errorf("error while loading order %s: %w", orderID, err)
 		}
 		return nil
@@ -254,55 +397,60 @@ func (m *Manager) Login(login string, password string) error {
 	return errors2.ErrNoSuchUser
 }
 
-// GetUserBalance возвращает баланс пользователя с указанным логином.
-func (m *Manager) getUserBalance(login string) (float64, error) {
-	// Запрос для получения баланса пользователя.
-	getUserBalanceQuery := "select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw w on o.login = w.login where o.login = $1 group by o.login;"
-	row := m.db.QueryRow(getUserBalanceQuery, login)
-	var balance sql.NullFloat64
-	if err := row.Scan(&balance); err != nil {
+// getUserBalance возвращает баланс пользователя с указанным логином внутри транзакции tx.
+func getUserBalance(tx *sql.Tx, login string) (models.Money, error) {
+	getUserBalanceQuery := `select current from balances where login = $1`
+	var balance models.Money
+	if err := tx.QueryRow(getUserBalanceQuery, login).Scan(&balance); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, nil
 		}
 		return 0, fmt.Errorf("error while getting user balance: %w", err)
-
 	}
-	return balance.Float64, nil
-
+	return balance, nil
 }
 
-// init создает необходимые таблицы, если они еще не существуют.
-func (m *Manager) init(ctx context.Context) error {
-	// Создание таблицы зарегистрированных пользователей, если она не существует.
-	createRegisteredQuery := `create table if not exists registered_users (login text primary key, password text)`
-	if _, err := m.db.ExecContext(ctx, createRegisteredQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with registered users: %w", err)
-	}
-	// Создание таблицы заказов, если она не существует.
-	createOrdersQuery := `create table if not exists orders (order_id text unique, login text, uploaded_at timestamp with time zone, status text, accrual double precision, primary key(order_id))`
-	if _, err := m.db.ExecContext(ctx, createOrdersQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with orders: %w", err)
-	}
-	// Создание таблицы выводов, если она не существует.
-	createWithdrawQuery := `create table if not exists withdraw (login text, order_id text unique, processed_at timestamp with time zone, amount double precision, primary key(login, order_id))`
-	if _, err := m.db.ExecContext(ctx, createWithdrawQuery); err != nil {
-		return fmt.Errorf("error while trying to create table with orders: %w", err)
+// checkSchema проверяет, что к базе данных применены все миграции, известные этой версии сервиса.
+func (m *Manager) checkSchema(ctx context.Context) error {
+	var version int
+	if err := m.db.QueryRowContext(ctx, `select coalesce(max(version), 0) from schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("error while selecting schema version: %w", err)
+	}
+	if latest := migrations.Latest(); version < latest {
+		return fmt.Errorf("%w: version %d, expected %d", errors2.ErrSchemaOutdated, version, latest)
 	}
 	return nil
 }
 
-// New создает новый экземпляр Manager с переданным db и инициализирует необходимые таблицы.
+// New создает новый экземпляр Manager с переданным db и проверяет, что схема базы данных актуальна.
+// Схема создаётся и обновляется миграциями из пакета migrations.
 func New(ctx context.Context, db *sql.DB) (*Manager, error) {
 	m := Manager{
 		db: db,
 	}
-	// Инициализация таблиц.
-	if err := m.init(ctx); err != nil {
+	if err := m.checkSchema(ctx); err != nil {
 		return nil, err
 	}
 	return &m, nil
 }
 
+const (
+	pollBackoffBase = time.Second     // pollBackoffBase это задержка перед повторным опросом заказа после первой попытки.
+	pollBackoffMax  = 5 * time.Minute // pollBackoffMax это максимальная задержка между опросами заказа.
+	// pollBackoffMaxExponent ограничивает показатель степени в расчёте задержки опроса, чтобы power(2, poll_attempts)
+	// не переполнял numeric у долго опрашиваемых заказов; pollBackoffBase * 2^pollBackoffMaxExponent уже больше pollBackoffMax.
+	pollBackoffMaxExponent = 16
+	// callbackPollDelay это задержка запасного опроса заказа после обратного вызова системы начисления.
+	callbackPollDelay = 10 * time.Minute
+)
+
+// Источники записей истории статусов заказа.
+const (
+	historySourceUpload   = "upload"   // historySourceUpload заказ загружен пользователем.
+	historySourcePoll     = "poll"     // historySourcePoll статус получен опросом системы начисления.
+	historySourceCallback = "callback" // historySourceCallback статус получен обратным вызовом системы начисления.
+)
+
 // Manager представляет менеджер базы данных.
 type Manager struct {
 	db *sql.DB
@@ -6,82 +6,102 @@ import (
 	"errors"
 	"github.com/DATA-DOG/go-sqlmock"
 	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/migrations"
 	"github.com/ZnNr/Go-GopherMart.git/internal/models"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestManager_GetAllOrders(t *testing.T) {
-	t.Run("positive: orders exist", func(t *testing.T) {
-		ctx := context.Background()
-		db, mock, err := sqlmock.New()
-		if err != nil {
-			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+// expectInit описывает запрос, которым New проверяет версию схемы базы данных.
+func expectInit(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(max(version), 0) from schema_migrations`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(migrations.Latest()))
+}
+
+// expectPost описывает запись проводки журнала баллов: сумма amount переходит со счёта from на счёт to.
+func expectPost(mock sqlmock.Sqlmock, kind string, orderID string, from string, to string, amount models.Money) {
+	mock.ExpectQuery(regexp.QuoteMeta(`insert into ledger_transactions (kind, order_id) values ($1, $2) returning id`)).WithArgs(kind, orderID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`insert into ledger_entries (transaction_id, account, amount) values ($1, $2, $3), ($1, $4, $5)`)).
+		WithArgs(int64(1), from, -amount, to, amount).WillReturnResult(sqlmock.NewResult(0, 2))
+	if login, ok := strings.CutPrefix(from, userAccountPrefix); ok {
+		withdrawn := models.Money(0)
+		if kind == ledgerKindWithdrawal {
+			withdrawn = amount
 		}
-		defer db.Close()
+		mock.ExpectExec(`insert into balances`).WithArgs(login, -amount, withdrawn).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	if login, ok := strings.CutPrefix(to, userAccountPrefix); ok {
+		mock.ExpectExec(`insert into balances`).WithArgs(login, amount, models.Money(0)).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+}
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+func TestManager_ClaimDueOrders(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
 
-		mock.ExpectQuery(`select order_id from orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow("100500"))
+	expectInit(mock)
 
-		manager, err := New(ctx, db)
-		assert.NoError(t, err)
-		orders, err := manager.GetAllOrders()
-		assert.NoError(t, err)
-		assert.Equal(t, orders, []string{"100500"})
-	})
+	mock.ExpectQuery(`update orders set next_poll_at = now\(\) \+ make_interval\(secs => \$2\)\s+where order_id in \(\s+select order_id from orders\s+where status in \('NEW', 'PROCESSING'\) and next_poll_at <= now\(\) and quarantined_at is null\s+order by next_poll_at\s+limit \$1\s+for update skip locked`).
+		WithArgs(10, time.Minute.Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow("100500").AddRow("100501"))
 
-	t.Run("positive: no orders", func(t *testing.T) {
-		ctx := context.Background()
-		db, mock, err := sqlmock.New()
-		if err != nil {
-			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-		}
-		defer db.Close()
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+	orders, err := manager.ClaimDueOrders(10, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"100500", "100501"}, orders)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+func TestManager_ScheduleNextPoll(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
 
-		mock.ExpectQuery(`select order_id from orders`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}))
+	expectInit(mock)
 
-		manager, err := New(ctx, db)
-		assert.NoError(t, err)
-		orders, err := manager.GetAllOrders()
-		assert.NoError(t, err)
-		assert.Equal(t, orders, []string{})
-	})
+	mock.ExpectExec(regexp.QuoteMeta(`update orders set poll_failures = 0, poll_attempts = poll_attempts + 1`)).
+		WithArgs("100500", pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), pollBackoffMaxExponent, callbackPollDelay.Seconds()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+	assert.NoError(t, manager.ScheduleNextPoll("100500"))
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestManager_GetBalanceInfo(t *testing.T) {
 	testCases := []struct {
-		name        string
-		balance     *sqlmock.Rows
-		withdrawals *sqlmock.Rows
-		result      string
+		name    string
+		balance *sqlmock.Rows
+		result  string
 	}{
 		{
-			name:        "positive",
-			balance:     sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}).AddRow(30.4),
-			result:      `{"current":100.5,"withdrawn":30.4}`,
+			name:    "positive",
+			balance: sqlmock.NewRows([]string{"current", "withdrawn"}).AddRow("100.50", "30.40"),
+			result:  `{"current":100.50,"withdrawn":30.40}`,
 		},
 		{
-			name:        "positive: no withdrawals",
-			balance:     sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}),
-			result:      `{"current":100.5,"withdrawn":0}`,
+			name:    "positive: no withdrawals",
+			balance: sqlmock.NewRows([]string{"current", "withdrawn"}).AddRow("100.50", "0"),
+			result:  `{"current":100.50,"withdrawn":0.00}`,
 		},
 		{
-			name:        "positive: no withdrawals and no accruals",
-			balance:     sqlmock.NewRows([]string{"balance"}),
-			withdrawals: sqlmock.NewRows([]string{"withdrawn"}),
-			result:      `{"current":0,"withdrawn":0}`,
+			name:    "positive: no withdrawals and no accruals",
+			balance: sqlmock.NewRows([]string{"current", "withdrawn"}),
+			result:  `{"current":0.00,"withdrawn":0.00}`,
 		},
 	}
 	for _, tt := range testCases {
@@ -92,13 +112,10 @@ func TestManager_GetBalanceInfo(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw`)).WillReturnRows(tt.balance)
-			mock.ExpectQuery(regexp.QuoteMeta(`select sum(amount) as withdrawn from withdraw where login`)).WillReturnRows(tt.withdrawals)
+			mock.ExpectQuery(regexp.QuoteMeta(`select current, withdrawn from balances where login = $1`)).WithArgs("test-login").WillReturnRows(tt.balance)
 			manager, err := New(ctx, db)
 			assert.NoError(t, err)
 
@@ -118,11 +135,11 @@ func TestManager_GetWithdrawals(t *testing.T) {
 	}{
 		{
 			name: "positive",
-			withdrawals: sqlmock.NewRows([]string{"order_id", "amount", "processed_at"}).AddRow("100500", 100.5, time.Date(2021, 8, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("100501", 200.5, time.Date(2021, 9, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("100502", 300.5, time.Date(2021, 10, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("100503", 320.5, time.Date(2021, 11, 15, 14, 30, 45, 100, time.Local)),
-			result: `[{"order":"100500","processed_at":"2021-08-15T14:30:45.0000001+03:00","sum":100.5},{"order":"100501","processed_at":"2021-09-15T14:30:45.0000001+03:00","sum":200.5},{"order":"100502","processed_at":"2021-10-15T14:30:45.0000001+03:00","sum":300.5},{"order":"100503","processed_at":"2021-11-15T14:30:45.0000001+03:00","sum":320.5}]`,
+			withdrawals: sqlmock.NewRows([]string{"order_id", "amount", "processed_at"}).AddRow("100500", "100.50", time.Date(2021, 8, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("100501", "200.50", time.Date(2021, 9, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("100502", "300.50", time.Date(2021, 10, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("100503", "320.50", time.Date(2021, 11, 15, 14, 30, 45, 100, time.Local)),
+			result: `[{"order":"100500","processed_at":"2021-08-15T14:30:45.0000001+03:00","sum":100.50},{"order":"100501","processed_at":"2021-09-15T14:30:45.0000001+03:00","sum":200.50},{"order":"100502","processed_at":"2021-10-15T14:30:45.0000001+03:00","sum":300.50},{"order":"100503","processed_at":"2021-11-15T14:30:45.0000001+03:00","sum":320.50}]`,
 		},
 		{
 			name:          "negative: no data",
@@ -138,9 +155,7 @@ func TestManager_GetWithdrawals(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select order_id, amount, processed_at from withdraw`)).WillReturnRows(tt.withdrawals)
@@ -161,20 +176,30 @@ func TestManager_Withdraw(t *testing.T) {
 	testCases := []struct {
 		name          string
 		balance       *sqlmock.Rows
-		sum           float64
+		sum           models.Money
 		expectedError error
 	}{
 		{
 			name:    "positive",
-			sum:     50.5,
-			balance: sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
+			sum:     5050,
+			balance: sqlmock.NewRows([]string{"balance"}).AddRow("100.50"),
 		},
 		{
 			name:          "negative: insufficient balance",
-			sum:           150.5,
-			balance:       sqlmock.NewRows([]string{"balance"}).AddRow(100.5),
+			sum:           15050,
+			balance:       sqlmock.NewRows([]string{"balance"}).AddRow("100.50"),
 			expectedError: errors2.ErrInsufficientBalance,
 		},
+		{
+			name:          "negative: zero sum",
+			sum:           0,
+			expectedError: errors2.ErrInvalidAmount,
+		},
+		{
+			name:          "negative: negative sum",
+			sum:           -5050,
+			expectedError: errors2.ErrInvalidAmount,
+		},
 	}
 	for _, tt := range testCases {
 		ctx := context.Background()
@@ -184,18 +209,31 @@ func TestManager_Withdraw(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
-			mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(sum(accrual), 0) - coalesce(sum(amount), 0) as balance from orders o left join withdraw`)).WillReturnRows(tt.balance)
-			mock.ExpectExec(`insert into withdraw values`).WillReturnResult(sqlmock.NewResult(0, 1))
+			if tt.balance != nil {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(`select login from registered_users where login = $1 for update`)).WithArgs("test-login").
+					WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("test-login"))
+				mock.ExpectQuery(regexp.QuoteMeta(`select current from balances where login = $1`)).WithArgs("test-login").WillReturnRows(tt.balance)
+			}
+			switch {
+			case tt.balance == nil:
+				// Неположительная сумма отклоняется без обращения к базе данных
+			case tt.expectedError == nil:
+				mock.ExpectExec(`insert into withdraw values`).WithArgs("test-login", "100500", tt.sum).WillReturnResult(sqlmock.NewResult(0, 1))
+				expectPost(mock, ledgerKindWithdrawal, "100500", "user:test-login", accountWithdrawals, tt.sum)
+				mock.ExpectCommit()
+			default:
+				mock.ExpectRollback()
+			}
 			manager, err := New(ctx, db)
 			assert.NoError(t, err)
 
 			err = manager.Withdraw("test-login", "100500", tt.sum)
 			assert.Equal(t, err, tt.expectedError)
+			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
@@ -210,11 +248,11 @@ func TestManager_GetUserOrders(t *testing.T) {
 		{
 			name: "positive",
 			orders: sqlmock.NewRows([]string{"order_id", "status", "accrual", "uploaded_at"}).
-				AddRow("1", "NEW", 100.5, time.Date(2021, 8, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("2", "PROCESSED", 20.1, time.Date(2021, 9, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("3", "PROCESSING", 0.01, time.Date(2021, 10, 15, 14, 30, 45, 100, time.Local)).
-				AddRow("4", "INVALID", 0.8, time.Date(2021, 11, 15, 14, 30, 45, 100, time.Local)),
-			result: `[{"number":"1","uploaded_at":"2021-08-15T14:30:45.0000001+03:00","status":"NEW","accrual":100.5},{"number":"2","uploaded_at":"2021-09-15T14:30:45.0000001+03:00","status":"PROCESSED","accrual":20.1},{"number":"3","uploaded_at":"2021-10-15T14:30:45.0000001+03:00","status":"PROCESSING","accrual":0.01},{"number":"4","uploaded_at":"2021-11-15T14:30:45.0000001+03:00","status":"INVALID","accrual":0.8}]`,
+				AddRow("1", "NEW", "100.50", time.Date(2021, 8, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("2", "PROCESSED", "20.10", time.Date(2021, 9, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("3", "PROCESSING", "0.01", time.Date(2021, 10, 15, 14, 30, 45, 100, time.Local)).
+				AddRow("4", "INVALID", "0.80", time.Date(2021, 11, 15, 14, 30, 45, 100, time.Local)),
+			result: `[{"number":"1","uploaded_at":"2021-08-15T14:30:45.0000001+03:00","status":"NEW","accrual":100.50},{"number":"2","uploaded_at":"2021-09-15T14:30:45.0000001+03:00","status":"PROCESSED","accrual":20.10},{"number":"3","uploaded_at":"2021-10-15T14:30:45.0000001+03:00","status":"PROCESSING","accrual":0.01},{"number":"4","uploaded_at":"2021-11-15T14:30:45.0000001+03:00","status":"INVALID","accrual":0.80}]`,
 		},
 		{
 			name:        "positive: no data",
@@ -230,9 +268,7 @@ func TestManager_GetUserOrders(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select order_id, status, accrual, uploaded_at from orders`)).WithArgs("test-login").WillReturnRows(tt.orders)
@@ -258,9 +294,7 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		login := "test-login"
 		order := "100500"
@@ -270,16 +304,78 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 			OrderID:   order,
 			Order:     &order,
 			CreatedAt: &orderTime,
-			Status:    "NOW",
-			Accrual:   100.5,
+			Status:    models.OrderStatusProcessed,
+			Accrual:   10050,
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`select status, login from orders where order_id = $1 for update`)).WithArgs(info.OrderID).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "login"}).AddRow("PROCESSING", "test-login"))
+		mock.ExpectExec(regexp.QuoteMeta(`update orders set status=$1, accrual=$2 where order_id=$3 and status in ($4, $5)`)).
+			WithArgs(info.Status, info.Accrual, info.OrderID, "NEW", "PROCESSING").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`insert into order_status_history (order_id, status, accrual, source) values ($1, $2, $3, $4)`)).
+			WithArgs(info.OrderID, info.Status, info.Accrual, historySourcePoll).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectPost(mock, ledgerKindAccrual, order, accountAccruals, "user:test-login", info.Accrual)
+		mock.ExpectCommit()
+		manager, err := New(ctx, db)
+		assert.NoError(t, err)
+
+		err = manager.UpdateOrderInfo(&info)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("negative: forbidden transition", func(t *testing.T) {
+		ctx := context.Background()
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 		}
+		defer db.Close()
 
-		mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
+
+		order := "100500"
+		info := models.OrderInfo{
+			OrderID: order,
+			Order:   &order,
+			Status:  models.OrderStatusProcessing,
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`select status, login from orders where order_id = $1 for update`)).WithArgs(info.OrderID).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "login"}).AddRow("PROCESSED", "test-login"))
+		mock.ExpectExec(regexp.QuoteMeta(`update orders set status=$1, accrual=$2 where order_id=$3 and status in ($4, $5)`)).
+			WithArgs(info.Status, info.Accrual, info.OrderID, "NEW", "PROCESSING").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
 
 		err = manager.UpdateOrderInfo(&info)
+		assert.ErrorIs(t, err, errors2.ErrForbiddenTransition)
+	})
+	t.Run("negative: unknown status", func(t *testing.T) {
+		ctx := context.Background()
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectInit(mock)
+
+		order := "100500"
+		info := models.OrderInfo{
+			OrderID: order,
+			Order:   &order,
+			Status:  "REGISTERED",
+		}
+
+		manager, err := New(ctx, db)
 		assert.NoError(t, err)
+
+		err = manager.UpdateOrderInfo(&info)
+		assert.ErrorIs(t, err, errors2.ErrForbiddenTransition)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 	t.Run("negative", func(t *testing.T) {
 		ctx := context.Background()
@@ -289,9 +385,7 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		login := "test-login"
 		order := "100500"
@@ -301,11 +395,15 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 			OrderID:   order,
 			Order:     &order,
 			CreatedAt: &orderTime,
-			Status:    "NOW",
-			Accrual:   100.5,
+			Status:    models.OrderStatusProcessed,
+			Accrual:   10050,
 		}
 
-		mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID).WillReturnError(errors.New("some error"))
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`select status, login from orders where order_id = $1 for update`)).WithArgs(info.OrderID).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "login"}).AddRow("NEW", "test-login"))
+		mock.ExpectExec(regexp.QuoteMeta(`update orders set`)).WithArgs(info.Status, info.Accrual, info.OrderID, "NEW", "PROCESSING").WillReturnError(errors.New("some error"))
+		mock.ExpectRollback()
 		manager, err := New(ctx, db)
 		assert.NoError(t, err)
 
@@ -314,6 +412,61 @@ func TestManager_UpdateOrderInfo(t *testing.T) {
 	})
 }
 
+func TestManager_GetOrderHistory(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	uploadedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta(`select h.status, coalesce(h.accrual, 0), h.changed_at from order_status_history h`)).WithArgs("100500", "test-login").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "accrual", "changed_at"}).
+			AddRow("NEW", nil, uploadedAt).
+			AddRow("PROCESSED", "100.50", uploadedAt.Add(time.Minute)))
+	mock.ExpectQuery(regexp.QuoteMeta(`select h.status, coalesce(h.accrual, 0), h.changed_at from order_status_history h`)).WithArgs("100500", "other-login").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "accrual", "changed_at"}))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	history, err := manager.GetOrderHistory("test-login", "100500")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"status":"NEW","accrual":0,"changed_at":"2024-03-01T10:00:00Z"},{"status":"PROCESSED","accrual":100.5,"changed_at":"2024-03-01T10:01:00Z"}]`, string(history))
+	_, err = manager.GetOrderHistory("other-login", "100500")
+	assert.ErrorIs(t, err, errors2.ErrNoData)
+}
+
+func TestManager_ApplyCallback(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	order := "100500"
+	info := models.OrderInfo{
+		OrderID: order,
+		Order:   &order,
+		Status:  models.OrderStatusProcessing,
+	}
+	// Повторный статус не записывается в историю
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`select status, login from orders where order_id = $1 for update`)).WithArgs(info.OrderID).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "login"}).AddRow("PROCESSING", "test-login"))
+	mock.ExpectExec(regexp.QuoteMeta(`update orders set status=$1, accrual=$2, callback_at=now(), next_poll_at=now() + make_interval(secs => $4) where order_id=$3 and status in ($5, $6)`)).
+		WithArgs(info.Status, info.Accrual, info.OrderID, callbackPollDelay.Seconds(), "NEW", "PROCESSING").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.ApplyCallback(&info))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestManager_LoadOrder(t *testing.T) {
 	testCases := []struct {
 		name        string
@@ -345,14 +498,13 @@ func TestManager_LoadOrder(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select login from orders`)).WithArgs("100500").WillReturnRows(tt.orders)
 			if errors.Is(tt.ordersErr, sql.ErrNoRows) {
-				mock.ExpectExec(regexp.QuoteMeta(`insert into orders`)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(regexp.QuoteMeta(`insert into orders`)).
+					WithArgs("100500", "test-login", models.OrderStatusNew, 0, NewOrdersChannel, historySourceUpload).WillReturnResult(sqlmock.NewResult(0, 0))
 			}
 			manager, err := New(ctx, db)
 			assert.NoError(t, err)
@@ -376,9 +528,7 @@ func TestManager_Register(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		mock.ExpectExec(regexp.QuoteMeta(`insert into registered_users values`)).WillReturnResult(sqlmock.NewResult(0, 0))
 		manager, err := New(ctx, db)
@@ -395,9 +545,7 @@ func TestManager_Register(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		mock.ExpectExec(regexp.QuoteMeta(`insert into registered_users values`)).WillReturnError(errors2.ErrDuplicateKey{Key: "registered_users_pkey"})
 		manager, err := New(ctx, db)
@@ -447,9 +595,7 @@ func TestManager_Login(t *testing.T) {
 		}
 		defer db.Close()
 
-		mock.ExpectExec(`create table if not exists registered_users`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists orders`).WillReturnResult(sqlmock.NewResult(0, 0))
-		mock.ExpectExec(`create table if not exists withdraw`).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectInit(mock)
 
 		t.Run(tt.name, func(t *testing.T) {
 			mock.ExpectQuery(regexp.QuoteMeta(`select login, password from registered_users`)).WillReturnRows(tt.creds)
@@ -464,3 +610,16 @@ func TestManager_Login(t *testing.T) {
 		})
 	}
 }
+
+func TestNew_OutdatedSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`select coalesce(max(version), 0) from schema_migrations`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(migrations.Latest() - 1))
+	_, err = New(context.Background(), db)
+	assert.ErrorIs(t, err, errors2.ErrSchemaOutdated)
+}
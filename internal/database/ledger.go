@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"strings"
+)
+
+// post записывает в журнал баллов проводку вида kind по заказу orderID: сумма amount списывается со счёта from
+// и зачисляется на счёт to. Проводка состоит из двух записей с противоположными суммами, поэтому сумма всех
+// записей журнала всегда равна нулю. Записывается в транзакции tx вместе с изменением, которое её порождает.
+func post(tx *sql.Tx, kind string, orderID string, from string, to string, amount models.Money) error {
+	var transactionID int64
+	insertTransactionQuery := `insert into ledger_transactions (kind, order_id) values ($1, $2) returning id`
+	if err := tx.QueryRow(insertTransactionQuery, kind, orderID).Scan(&transactionID); err != nil {
+		return fmt.Errorf("error while recording %s ledger transaction of order %q: %w", kind, orderID, err)
+	}
+	insertEntriesQuery := `insert into ledger_entries (transaction_id, account, amount) values ($1, $2, $3), ($1, $4, $5)`
+	if _, err := tx.Exec(insertEntriesQuery, transactionID, from, -amount, to, amount); err != nil {
+		return fmt.Errorf("error while recording %s ledger entries of order %q: %w", kind, orderID, err)
+	}
+	// Поддерживаем баланс пользователей, чьи счета затронуты проводкой, в той же транзакции
+	if login, ok := strings.CutPrefix(from, userAccountPrefix); ok {
+		withdrawn := models.Money(0)
+		if kind == ledgerKindWithdrawal {
+			withdrawn = amount
+		}
+		if err := updateBalance(tx, login, -amount, withdrawn); err != nil {
+			return err
+		}
+	}
+	if login, ok := strings.CutPrefix(to, userAccountPrefix); ok {
+		if err := updateBalance(tx, login, amount, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateBalance изменяет баланс пользователя login на delta, а сумму его списаний на withdrawn.
+func updateBalance(tx *sql.Tx, login string, delta models.Money, withdrawn models.Money) error {
+	updateBalanceQuery := `insert into balances (login, current, withdrawn) values ($1, $2, $3)
+		on conflict (login) do update set current = balances.current + excluded.current, withdrawn = balances.withdrawn + excluded.withdrawn, updated_at = now()`
+	if _, err := tx.Exec(updateBalanceQuery, login, delta, withdrawn); err != nil {
+		return fmt.Errorf("error while updating balance of user %q: %w", login, err)
+	}
+	return nil
+}
+
+// userAccount возвращает счёт баллов пользователя login в журнале.
+func userAccount(login string) string {
+	return userAccountPrefix + login
+}
+
+// Виды проводок журнала баллов.
+const (
+	ledgerKindAccrual    = "accrual"    // ledgerKindAccrual начисление баллов по обработанному заказу.
+	ledgerKindWithdrawal = "withdrawal" // ledgerKindWithdrawal списание баллов в счёт заказа.
+	ledgerKindAdjustment = "adjustment" // ledgerKindAdjustment корректировка начисления по итогам сверки.
+)
+
+// Счета журнала баллов.
+const (
+	userAccountPrefix  = "user:"              // userAccountPrefix это префикс счетов пользователей.
+	accountAccruals    = "system:accruals"    // accountAccruals это счёт, с которого начисляются баллы пользователям.
+	accountWithdrawals = "system:withdrawals" // accountWithdrawals это счёт, на который списываются баллы пользователей.
+)
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
+	"time"
+)
+
+// NewOrdersChannel это канал уведомлений Postgres, в который LoadOrder отправляет номера новых заказов.
+const NewOrdersChannel = "new_orders"
+
+// defaultReconnectInterval это пауза перед повторной подпиской после потери соединения.
+const defaultReconnectInterval = time.Second
+
+// Run подписывается на канал и вызывает onNotify для каждого уведомления до отмены ctx.
+// Уведомления, отправленные, пока подписки нет, теряются, поэтому после каждой подписки
+// onNotify вызывается с пустым payload.
+func (l *Listener) Run(ctx context.Context) {
+	l.log.Infof("Listening to %q notifications", l.channel)
+	for {
+		if err := l.listen(ctx); err != nil && ctx.Err() == nil {
+			l.log.Errorf("error while listening to %q notifications, reconnecting in %s: %s", l.channel, l.reconnectInterval, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			l.log.Infof("Stop listening to %q notifications: context done", l.channel)
+			return
+		case <-time.After(l.reconnectInterval):
+		}
+	}
+}
+
+// listen занимает отдельное соединение и ждёт уведомлений, пока соединение живо и не отменён ctx.
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error while getting connection: %w", err)
+	}
+	defer conn.Close()
+	var listenErr error
+	_ = conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			listenErr = fmt.Errorf("unsupported driver connection %T", driverConn)
+			return nil
+		}
+		listenErr = l.wait(ctx, stdConn.Conn())
+		// Соединение с подпиской не возвращается в пул
+		return driver.ErrBadConn
+	})
+	return listenErr
+}
+
+// wait подписывается на канал и передаёт уведомления в onNotify.
+func (l *Listener) wait(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, "listen "+pgx.Identifier{l.channel}.Sanitize()); err != nil {
+		return fmt.Errorf("error while subscribing: %w", err)
+	}
+	l.onNotify("")
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("error while waiting for notification: %w", err)
+		}
+		l.onNotify(notification.Payload)
+	}
+}
+
+// NewListener создает Listener уведомлений Postgres в канале channel, вызывающий onNotify для каждого из них.
+func NewListener(db *sql.DB, channel string, onNotify func(payload string), log *zap.SugaredLogger) *Listener {
+	return &Listener{
+		db:                db,
+		channel:           channel,
+		onNotify:          onNotify,
+		log:               log,
+		reconnectInterval: defaultReconnectInterval,
+	}
+}
+
+// Listener получает уведомления Postgres, отправленные через NOTIFY.
+type Listener struct {
+	db                *sql.DB
+	channel           string
+	onNotify          func(payload string)
+	log               *zap.SugaredLogger
+	reconnectInterval time.Duration
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPollBackoffMaxExponent(t *testing.T) {
+	// Ограничение показателя степени не должно опускать задержку ниже pollBackoffMax
+	assert.GreaterOrEqual(t, pollBackoffBase*(1<<pollBackoffMaxExponent), pollBackoffMax)
+}
+
+// TestManager_PollBackoffLargeAttempts проверяет на настоящей базе данных, что задержка опроса заказа
+// с большим числом попыток не переполняется и ограничена pollBackoffMax.
+func TestManager_PollBackoffLargeAttempts(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	suffix := time.Now().UnixNano()
+	login := fmt.Sprintf("poll-test-%d", suffix)
+	orderID := fmt.Sprintf("%d", suffix)
+	cleanupTestUser(t, db, login)
+	require.NoError(t, manager.Register(login, "password"))
+	require.NoError(t, manager.LoadOrder(login, orderID))
+
+	var delay float64
+	selectDelayQuery := `select extract(epoch from next_poll_at - last_polled_at) from orders where order_id = $1`
+	for _, attempts := range []int{1024, 100000} {
+		_, err := db.Exec(`update orders set poll_attempts = $2 where order_id = $1`, orderID, attempts)
+		require.NoError(t, err)
+		require.NoError(t, manager.ScheduleNextPoll(orderID))
+		require.NoError(t, db.QueryRow(selectDelayQuery, orderID).Scan(&delay))
+		assert.InDelta(t, pollBackoffMax.Seconds(), delay, 1)
+
+		_, err = db.Exec(`update orders set poll_attempts = $2 where order_id = $1`, orderID, attempts)
+		require.NoError(t, err)
+		_, err = manager.RecordPollFailure(orderID, "some error", 10)
+		require.NoError(t, err)
+		require.NoError(t, db.QueryRow(selectDelayQuery, orderID).Scan(&delay))
+		assert.InDelta(t, pollBackoffMax.Seconds(), delay, 1)
+	}
+}
+
+// TestManager_PollAfterCallbackInFlight проверяет на настоящей базе данных, что опрос, завершившийся после
+// обратного вызова системы начисления, не переносит следующий опрос заказа раньше запасного.
+func TestManager_PollAfterCallbackInFlight(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	suffix := time.Now().UnixNano()
+	login := fmt.Sprintf("callback-test-%d", suffix)
+	orderID := fmt.Sprintf("%d", suffix)
+	cleanupTestUser(t, db, login)
+	require.NoError(t, manager.Register(login, "password"))
+	require.NoError(t, manager.LoadOrder(login, orderID))
+
+	// Обратный вызов приходит, пока опрос заказа ещё в полёте
+	require.NoError(t, manager.ApplyCallback(&models.OrderInfo{OrderID: orderID, Order: &orderID, Status: models.OrderStatusProcessing}))
+
+	var delay float64
+	selectDelayQuery := `select extract(epoch from next_poll_at - callback_at) from orders where order_id = $1`
+	require.NoError(t, manager.ScheduleNextPoll(orderID))
+	require.NoError(t, db.QueryRow(selectDelayQuery, orderID).Scan(&delay))
+	assert.GreaterOrEqual(t, delay, callbackPollDelay.Seconds())
+
+	_, err := manager.RecordPollFailure(orderID, "some error", 10)
+	require.NoError(t, err)
+	require.NoError(t, db.QueryRow(selectDelayQuery, orderID).Scan(&delay))
+	assert.GreaterOrEqual(t, delay, callbackPollDelay.Seconds())
+}
+
+// TestManager_DeferPollKeepsFailures проверяет на настоящей базе данных, что отложенный из-за недоступности системы начисления
+// опрос не меняет счётчик ошибок заказа.
+func TestManager_DeferPollKeepsFailures(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	suffix := time.Now().UnixNano()
+	login := fmt.Sprintf("defer-test-%d", suffix)
+	orderID := fmt.Sprintf("%d", suffix)
+	cleanupTestUser(t, db, login)
+	require.NoError(t, manager.Register(login, "password"))
+	require.NoError(t, manager.LoadOrder(login, orderID))
+	_, err := db.Exec(`update orders set poll_failures = 3 where order_id = $1`, orderID)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.DeferPoll(orderID, "accrual system is unavailable"))
+	var (
+		failures int
+		delay    float64
+	)
+	require.NoError(t, db.QueryRow(`select poll_failures, extract(epoch from next_poll_at - last_polled_at) from orders where order_id = $1`, orderID).
+		Scan(&failures, &delay))
+	assert.Equal(t, 3, failures)
+	assert.Greater(t, delay, 0.0)
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ZnNr/Go-GopherMart.git/internal/migrations"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+)
+
+// openTestDB подключается к настоящей тестовой базе данных, строка подключения к которой задаётся переменной
+// окружения TEST_DATABASE_URI, и применяет к ней миграции. Если переменная не задана, тест пропускается.
+func openTestDB(t *testing.T) (*sql.DB, *Manager) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	migrator, err := migrations.New(db, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	manager, err := New(ctx, db)
+	require.NoError(t, err)
+	return db, manager
+}
+
+// cleanupTestUser удаляет после теста пользователя login вместе с его заказами, списаниями и записями журнала баллов.
+func cleanupTestUser(t *testing.T, db *sql.DB, login string) {
+	t.Cleanup(func() {
+		db.Exec(`with t as (select transaction_id from ledger_entries where account = $1),
+			e as (delete from ledger_entries where transaction_id in (select transaction_id from t))
+			delete from ledger_transactions where id in (select transaction_id from t)`, userAccount(login))
+		db.Exec(`delete from balances where login = $1`, login)
+		db.Exec(`delete from withdraw where login = $1`, login)
+		db.Exec(`delete from order_status_history where order_id in (select order_id from orders where login = $1)`, login)
+		db.Exec(`delete from orders where login = $1`, login)
+		db.Exec(`delete from registered_users where login = $1`, login)
+	})
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+)
+
+// RecordPollFailure учитывает ошибку опроса заказа и откладывает его следующий опрос. Если ошибок подряд
+// набралось quarantineAfter, заказ помещается в карантин и больше не опрашивается. Возвращает true, если заказ в карантине.
+func (m *Manager) RecordPollFailure(orderID string, reason string, quarantineAfter int) (bool, error) {
+	recordPollFailureQuery := `update orders set poll_failures = poll_failures + 1, last_error = $2,
+		poll_attempts = poll_attempts + 1, last_polled_at = now(), next_poll_at = greatest(now() + make_interval(secs => least($3 * power(2, least(poll_attempts, $6)), $4)), callback_at + make_interval(secs => $7)),
+		quarantined_at = case when quarantined_at is null and poll_failures + 1 >= $5 then now() else quarantined_at end
+		where order_id = $1
+		returning quarantined_at is not null`
+	var quarantined bool
+	err := m.db.QueryRow(recordPollFailureQuery, orderID, reason, pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), quarantineAfter, pollBackoffMaxExponent, callbackPollDelay.Seconds()).Scan(&quarantined)
+	if err != nil {
+		return false, fmt.Errorf("error while recording poll failure of order %q: %w", orderID, err)
+	}
+	return quarantined, nil
+}
+
+// DeferPoll откладывает следующий опрос заказа, который не удалось выполнить из-за недоступности системы начисления,
+// с той же задержкой, что и после ошибки опроса. Счётчик ошибок заказа не меняется: сбой всей системы начисления
+// не приближает заказ к карантину и не стирает его собственные ошибки.
+func (m *Manager) DeferPoll(orderID string, reason string) error {
+	deferPollQuery := `update orders set last_error = $2, poll_attempts = poll_attempts + 1, last_polled_at = now(),
+		next_poll_at = greatest(now() + make_interval(secs => least($3 * power(2, least(poll_attempts, $5)), $4)), callback_at + make_interval(secs => $6))
+		where order_id = $1`
+	if _, err := m.db.Exec(deferPollQuery, orderID, reason, pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), pollBackoffMaxExponent, callbackPollDelay.Seconds()); err != nil {
+		return fmt.Errorf("error while deferring poll of order %q: %w", orderID, err)
+	}
+	return nil
+}
+
+// GetQuarantinedOrders получает заказы, находящиеся в карантине.
+func (m *Manager) GetQuarantinedOrders() ([]byte, error) {
+	rows, err := m.db.Query(selectQuarantinedOrdersQuery + ` order by quarantined_at`)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting quarantined orders from db: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+	// Слайс для хранения заказов в карантине.
+	orders := make([]models.QuarantinedOrder, 0)
+	for rows.Next() {
+		order, err := scanQuarantinedOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	if len(orders) == 0 {
+		return nil, errors2.ErrNoData
+	}
+	result, err := json.Marshal(orders)
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling quarantined orders: %w", err)
+	}
+	return result, nil
+}
+
+// GetQuarantinedOrder получает заказ в карантине по его номеру.
+func (m *Manager) GetQuarantinedOrder(orderID string) ([]byte, error) {
+	order, err := scanQuarantinedOrder(m.db.QueryRow(selectQuarantinedOrdersQuery+` and order_id = $1`, orderID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors2.ErrNoData
+	}
+	if err != nil {
+		return nil, err
+	}
+	result, err := json.Marshal(order)
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling quarantined order: %w", err)
+	}
+	return result, nil
+}
+
+// RequeueOrder возвращает заказ из карантина в опрос со сброшенными счётчиками ошибок и попыток.
+func (m *Manager) RequeueOrder(orderID string) error {
+	requeueOrderQuery := `update orders set quarantined_at = null, poll_failures = 0, poll_attempts = 0, next_poll_at = now() where order_id = $1 and quarantined_at is not null`
+	result, err := m.db.Exec(requeueOrderQuery, orderID)
+	if err != nil {
+		return fmt.Errorf("error while requeueing order %q: %w", orderID, err)
+	}
+	requeued, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error while getting requeued orders count: %w", err)
+	}
+	if requeued == 0 {
+		return errors2.ErrNoData
+	}
+	return nil
+}
+
+// selectQuarantinedOrdersQuery выбирает заказы в карантине; к нему дописываются дополнительные условия.
+const selectQuarantinedOrdersQuery = `select order_id, login, status, uploaded_at, poll_failures, coalesce(last_error, ''), quarantined_at from orders where quarantined_at is not null`
+
+// scanQuarantinedOrder считывает заказ в карантине из строки результата запроса.
+func scanQuarantinedOrder(row interface{ Scan(dest ...any) error }) (*models.QuarantinedOrder, error) {
+	var order models.QuarantinedOrder
+	err := row.Scan(&order.OrderID, &order.UserName, &order.Status, &order.CreatedAt, &order.PollFailures, &order.LastError, &order.QuarantinedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error while scanning rows: %w", err)
+	}
+	return &order, nil
+}
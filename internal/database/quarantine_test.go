@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestManager_RecordPollFailure(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`update orders set poll_failures = poll_failures + 1, last_error = $2`)).
+		WithArgs("100500", "some error", pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), 3, pollBackoffMaxExponent, callbackPollDelay.Seconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"quarantined"}).AddRow(true))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	quarantined, err := manager.RecordPollFailure("100500", "some error", 3)
+	assert.NoError(t, err)
+	assert.True(t, quarantined)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_DeferPoll(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`update orders set last_error = $2, poll_attempts = poll_attempts + 1`)).
+		WithArgs("100500", "accrual system is unavailable", pollBackoffBase.Seconds(), pollBackoffMax.Seconds(), pollBackoffMaxExponent, callbackPollDelay.Seconds()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.DeferPoll("100500", "accrual system is unavailable"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestManager_GetQuarantinedOrder(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	uploadedAt := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	quarantinedAt := uploadedAt.Add(time.Hour)
+	columns := []string{"order_id", "login", "status", "uploaded_at", "poll_failures", "last_error", "quarantined_at"}
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuarantinedOrdersQuery + ` and order_id = $1`)).WithArgs("100500").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("100500", "test-login", "NEW", uploadedAt, 10, "some error", quarantinedAt))
+	mock.ExpectQuery(regexp.QuoteMeta(selectQuarantinedOrdersQuery + ` and order_id = $1`)).WithArgs("100501").
+		WillReturnRows(sqlmock.NewRows(columns))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	order, err := manager.GetQuarantinedOrder("100500")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"number":"100500","user":"test-login","status":"NEW","uploaded_at":"2024-03-01T10:00:00Z","poll_failures":10,"last_error":"some error","quarantined_at":"2024-03-01T11:00:00Z"}`, string(order))
+	_, err = manager.GetQuarantinedOrder("100501")
+	assert.ErrorIs(t, err, errors2.ErrNoData)
+}
+
+func TestManager_RequeueOrder(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`update orders set quarantined_at = null`)).WithArgs("100500").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`update orders set quarantined_at = null`)).WithArgs("100501").WillReturnResult(sqlmock.NewResult(0, 0))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, manager.RequeueOrder("100500"))
+	assert.ErrorIs(t, manager.RequeueOrder("100501"), errors2.ErrNoData)
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"time"
+)
+
+// GetProcessedOrders получает обработанные заказы, загруженные в интервале [from, to). Начисление по заказу
+// возвращается с учётом уже внесённых корректировок, чтобы исправленное расхождение не находилось повторно.
+func (m *Manager) GetProcessedOrders(from time.Time, to time.Time) ([]models.OrderInfo, error) {
+	getProcessedOrdersQuery := `select o.order_id, o.login, o.status, coalesce(o.accrual, 0) + coalesce(sum(a.amount), 0)
+		from orders o left join accrual_adjustments a on a.order_id = o.order_id
+		where o.status = $1 and o.uploaded_at >= $2 and o.uploaded_at < $3
+		group by o.order_id, o.login, o.status, o.accrual
+		order by o.order_id`
+	rows, err := m.db.Query(getProcessedOrdersQuery, models.OrderStatusProcessed, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting processed orders from db: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+		_ = rows.Err()
+	}()
+	// Слайс для хранения обработанных заказов.
+	orders := make([]models.OrderInfo, 0)
+	for rows.Next() {
+		var (
+			order models.OrderInfo
+			login string
+		)
+		if err = rows.Scan(&order.OrderID, &login, &order.Status, &order.Accrual); err != nil {
+			return nil, fmt.Errorf("error while scanning rows: %w", err)
+		}
+		order.UserName = &login
+		order.Order = &order.OrderID
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// RecordDiscrepancy сохраняет найденное сверкой расхождение и заполняет его идентификатор. По заказу хранится
+// не больше одного неисправленного расхождения: если оно уже есть, в нём обновляются значения, найденные сверкой.
+// Возвращает true, если расхождение сохранено впервые или система начисления сообщила о заказе новые значения.
+func (m *Manager) RecordDiscrepancy(d *models.Discrepancy) (bool, error) {
+	recordDiscrepancyQuery := `with existing as (
+			select actual_status, actual_accrual from accrual_discrepancies where order_id = $1 and adjusted_at is null
+		), upserted as (
+			insert into accrual_discrepancies (order_id, login, recorded_status, recorded_accrual, actual_status, actual_accrual)
+			values ($1, $2, $3, $4, $5, $6)
+			on conflict (order_id) where adjusted_at is null do update set recorded_status = excluded.recorded_status,
+				recorded_accrual = excluded.recorded_accrual, actual_status = excluded.actual_status, actual_accrual = excluded.actual_accrual
+			returning id
+		)
+		select u.id, not exists (select 1 from existing e where e.actual_status = $5 and e.actual_accrual = $6) from upserted u`
+	var recorded bool
+	row := m.db.QueryRow(recordDiscrepancyQuery, d.OrderID, d.UserName, d.RecordedStatus, d.RecordedAccrual, d.ActualStatus, d.ActualAccrual)
+	if err := row.Scan(&d.ID, &recorded); err != nil {
+		return false, fmt.Errorf("error while recording discrepancy of order %q: %w", d.OrderID, err)
+	}
+	return recorded, nil
+}
+
+// ApplyAdjustment исправляет расхождение корректирующей записью начисления и отмечает его исправленным.
+// Начисление в самом заказе не меняется, чтобы история оставалась неизменной. Расхождение сначала отмечается
+// исправленным, поэтому параллельные сверки исправляют его только один раз. Возвращает false, если расхождение
+// уже исправлено.
+func (m *Manager) ApplyAdjustment(d *models.Discrepancy) (bool, error) {
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return false, fmt.Errorf("error while starting adjustment transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	markAdjustedQuery := `update accrual_discrepancies set adjusted_at = now() where id = $1 and adjusted_at is null`
+	result, err := tx.Exec(markAdjustedQuery, d.ID)
+	if err != nil {
+		return false, fmt.Errorf("error while marking discrepancy %d adjusted: %w", d.ID, err)
+	}
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error while getting marked discrepancies count: %w", err)
+	}
+	if marked != 1 {
+		return false, nil
+	}
+	insertAdjustmentQuery := `insert into accrual_adjustments (order_id, login, amount, discrepancy_id) values ($1, $2, $3, $4)`
+	if _, err = tx.Exec(insertAdjustmentQuery, d.OrderID, d.UserName, d.Adjustment(), d.ID); err != nil {
+		return false, fmt.Errorf("error while adjusting accrual of order %q: %w", d.OrderID, err)
+	}
+	if err = post(tx, ledgerKindAdjustment, d.OrderID, accountAccruals, userAccount(d.UserName), d.Adjustment()); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error while committing adjustment of order %q: %w", d.OrderID, err)
+	}
+	return true, nil
+}
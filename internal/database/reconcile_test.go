@@ -0,0 +1,255 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManager_GetProcessedOrders(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`select o.order_id, o.login, o.status, coalesce(o.accrual, 0) + coalesce(sum(a.amount), 0)`)).
+		WithArgs(models.OrderStatusProcessed, from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"order_id", "login", "status", "accrual"}).AddRow("100500", "test-login", "PROCESSED", "150.50"))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	orders, err := manager.GetProcessedOrders(from, to)
+	assert.NoError(t, err)
+	assert.Len(t, orders, 1)
+	assert.Equal(t, "test-login", *orders[0].UserName)
+	assert.Equal(t, models.Money(15050), orders[0].Accrual)
+}
+
+func TestManager_ApplyAdjustment(t *testing.T) {
+	d := &models.Discrepancy{
+		OrderID:         "100500",
+		UserName:        "test-login",
+		RecordedStatus:  models.OrderStatusProcessed,
+		RecordedAccrual: 10000,
+		ActualStatus:    models.OrderStatusProcessed,
+		ActualAccrual:   15000,
+	}
+	t.Run("positive", func(t *testing.T) {
+		ctx := context.Background()
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectInit(mock)
+		mock.ExpectQuery(regexp.QuoteMeta(`insert into accrual_discrepancies`)).
+			WithArgs(d.OrderID, d.UserName, d.RecordedStatus, d.RecordedAccrual, d.ActualStatus, d.ActualAccrual).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "recorded"}).AddRow(7, true))
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update accrual_discrepancies set adjusted_at = now() where id = $1 and adjusted_at is null`)).WithArgs(int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`insert into accrual_adjustments`)).WithArgs(d.OrderID, d.UserName, models.Money(5000), int64(7)).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectPost(mock, ledgerKindAdjustment, d.OrderID, accountAccruals, "user:test-login", 5000)
+		mock.ExpectCommit()
+		manager, err := New(ctx, db)
+		assert.NoError(t, err)
+
+		recorded, err := manager.RecordDiscrepancy(d)
+		assert.NoError(t, err)
+		assert.True(t, recorded)
+		assert.Equal(t, int64(7), d.ID)
+		applied, err := manager.ApplyAdjustment(d)
+		assert.NoError(t, err)
+		assert.True(t, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("positive: already adjusted", func(t *testing.T) {
+		ctx := context.Background()
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectInit(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update accrual_discrepancies set adjusted_at = now() where id = $1 and adjusted_at is null`)).WithArgs(int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		manager, err := New(ctx, db)
+		assert.NoError(t, err)
+
+		// Повторное исправление того же расхождения ничего не начисляет
+		applied, err := manager.ApplyAdjustment(d)
+		assert.NoError(t, err)
+		assert.False(t, applied)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("negative: rollback", func(t *testing.T) {
+		ctx := context.Background()
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		expectInit(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`update accrual_discrepancies set adjusted_at = now()`)).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`insert into accrual_adjustments`)).WillReturnError(errors.New("some error"))
+		mock.ExpectRollback()
+		manager, err := New(ctx, db)
+		assert.NoError(t, err)
+
+		_, err = manager.ApplyAdjustment(d)
+		assert.EqualError(t, err, `error while adjusting accrual of order "100500": some error`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestManager_RecordDiscrepancy(t *testing.T) {
+	d := &models.Discrepancy{
+		OrderID:         "100500",
+		UserName:        "test-login",
+		RecordedStatus:  models.OrderStatusProcessed,
+		RecordedAccrual: 10000,
+		ActualStatus:    models.OrderStatusProcessed,
+		ActualAccrual:   15000,
+	}
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expectInit(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`with existing as (`)).
+		WithArgs(d.OrderID, d.UserName, d.RecordedStatus, d.RecordedAccrual, d.ActualStatus, d.ActualAccrual).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recorded"}).AddRow(7, false))
+	manager, err := New(ctx, db)
+	assert.NoError(t, err)
+
+	recorded, err := manager.RecordDiscrepancy(d)
+	assert.NoError(t, err)
+	assert.False(t, recorded)
+	assert.Equal(t, int64(7), d.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestManager_RecordDiscrepancyRepeated проверяет на настоящей базе данных, что повторно найденное
+// неисправленное расхождение не сохраняется второй раз.
+func TestManager_RecordDiscrepancyRepeated(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	orderID := fmt.Sprintf("%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec(`delete from accrual_discrepancies where order_id = $1`, orderID)
+	})
+	newDiscrepancy := func(actual models.Money) *models.Discrepancy {
+		return &models.Discrepancy{OrderID: orderID, UserName: "test-login", RecordedStatus: models.OrderStatusProcessed,
+			RecordedAccrual: 10000, ActualStatus: models.OrderStatusProcessed, ActualAccrual: actual}
+	}
+	first := newDiscrepancy(15000)
+	recorded, err := manager.RecordDiscrepancy(first)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+
+	repeated := newDiscrepancy(15000)
+	recorded, err = manager.RecordDiscrepancy(repeated)
+	require.NoError(t, err)
+	assert.False(t, recorded)
+	assert.Equal(t, first.ID, repeated.ID)
+
+	// Новое начисление в системе начисления обновляет то же неисправленное расхождение
+	changed := newDiscrepancy(20000)
+	recorded, err = manager.RecordDiscrepancy(changed)
+	require.NoError(t, err)
+	assert.True(t, recorded)
+	assert.Equal(t, first.ID, changed.ID)
+	var actual models.Money
+	require.NoError(t, db.QueryRow(`select actual_accrual from accrual_discrepancies where id = $1`, first.ID).Scan(&actual))
+	assert.Equal(t, models.Money(20000), actual)
+}
+
+// TestManager_RecordDiscrepancyConcurrent проверяет на настоящей базе данных, что параллельные сверки
+// сохраняют по заказу одно неисправленное расхождение.
+func TestManager_RecordDiscrepancyConcurrent(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	orderID := fmt.Sprintf("%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		db.Exec(`delete from accrual_discrepancies where order_id = $1`, orderID)
+	})
+	const runs = 10
+	ids := make(chan int64, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := &models.Discrepancy{OrderID: orderID, UserName: "test-login", RecordedStatus: models.OrderStatusProcessed,
+				RecordedAccrual: 10000, ActualStatus: models.OrderStatusProcessed, ActualAccrual: 15000}
+			_, err := manager.RecordDiscrepancy(d)
+			assert.NoError(t, err)
+			ids <- d.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	first := <-ids
+	for id := range ids {
+		assert.Equal(t, first, id)
+	}
+	var open int
+	require.NoError(t, db.QueryRow(`select count(*) from accrual_discrepancies where order_id = $1 and adjusted_at is null`, orderID).Scan(&open))
+	assert.Equal(t, 1, open)
+}
+
+// TestManager_ApplyAdjustmentTwice проверяет на настоящей базе данных, что повторное исправление
+// одного расхождения не начисляет корректировку второй раз.
+func TestManager_ApplyAdjustmentTwice(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	suffix := time.Now().UnixNano()
+	login := fmt.Sprintf("adjust-test-%d", suffix)
+	orderID := fmt.Sprintf("%d", suffix)
+	cleanupTestUser(t, db, login)
+	t.Cleanup(func() {
+		db.Exec(`delete from accrual_adjustments where order_id = $1`, orderID)
+		db.Exec(`delete from accrual_discrepancies where order_id = $1`, orderID)
+	})
+	require.NoError(t, manager.Register(login, "password"))
+	d := &models.Discrepancy{OrderID: orderID, UserName: login, RecordedStatus: models.OrderStatusProcessed,
+		RecordedAccrual: 10000, ActualStatus: models.OrderStatusProcessed, ActualAccrual: 15000}
+	_, err := manager.RecordDiscrepancy(d)
+	require.NoError(t, err)
+
+	applied, err := manager.ApplyAdjustment(d)
+	require.NoError(t, err)
+	assert.True(t, applied)
+	applied, err = manager.ApplyAdjustment(d)
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	var adjustments int
+	require.NoError(t, db.QueryRow(`select count(*) from accrual_adjustments where discrepancy_id = $1`, d.ID).Scan(&adjustments))
+	assert.Equal(t, 1, adjustments)
+	var current models.Money
+	require.NoError(t, db.QueryRow(`select current from balances where login = $1`, login).Scan(&current))
+	assert.Equal(t, models.Money(5000), current)
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestManager_WithdrawConcurrent проверяет на настоящей базе данных, что параллельные списания
+// не уводят баланс в минус.
+func TestManager_WithdrawConcurrent(t *testing.T) {
+	db, manager := openTestDB(t)
+
+	// Пользователь с начислением 100 баллов по одному заказу
+	suffix := time.Now().UnixNano()
+	login := fmt.Sprintf("withdraw-test-%d", suffix)
+	orderID := fmt.Sprintf("%d", suffix)
+	cleanupTestUser(t, db, login)
+	require.NoError(t, manager.Register(login, "password"))
+	require.NoError(t, manager.LoadOrder(login, orderID))
+	require.NoError(t, manager.UpdateOrderInfo(&models.OrderInfo{OrderID: orderID, Order: &orderID, Status: models.OrderStatusProcessed, Accrual: 10000}))
+
+	// Двадцать параллельных списаний по 10 баллов: пройти должны ровно десять
+	const withdrawals = 20
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		succeeded    int
+		insufficient int
+	)
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := manager.Withdraw(login, fmt.Sprintf("%d%02d", suffix, i), 1000)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, errors2.ErrInsufficientBalance):
+				insufficient++
+			default:
+				t.Errorf("unexpected withdraw error: %s", err.Error())
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 10, succeeded)
+	assert.Equal(t, withdrawals-10, insufficient)
+
+	result, err := manager.GetBalanceInfo(login)
+	require.NoError(t, err)
+	var balance models.BalanceInfo
+	require.NoError(t, json.Unmarshal(result, &balance))
+	assert.Equal(t, models.BalanceInfo{Current: 0, Withdrawn: 10000}, balance)
+}
@@ -23,4 +23,7 @@ var (
 	ErrInsufficientBalance = errors.New("insufficient balance")                        // ErrInsufficientBalance представляет ошибку, возникающую при недостаточном балансе.
 	ErrNoSuchUser          = errors.New("no such user")                                // ErrNoSuchUser представляет ошибку, возникающую при отсутствии пользователя.
 	ErrInvalidCredentials  = errors.New("incorrect password")                          // ErrInvalidCredentials представляет ошибку, возникающую при неверных учетных данных.
+	ErrForbiddenTransition = errors.New("forbidden order status transition")           // ErrForbiddenTransition представляет ошибку, возникающую при попытке недопустимого перехода статуса заказа.
+	ErrSchemaOutdated      = errors.New("database schema is outdated")                 // ErrSchemaOutdated представляет ошибку, возникающую, если к базе данных применены не все миграции.
+	ErrInvalidAmount       = errors.New("amount must be positive")                     // ErrInvalidAmount представляет ошибку, возникающую при списании неположительной суммы.
 )
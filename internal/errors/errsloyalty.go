@@ -0,0 +1,25 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTooManyRequests представляет ошибку, возникающую при превышении лимита запросов к системе начисления.
+type ErrTooManyRequests struct {
+	RetryAfter time.Duration
+}
+
+// Error возвращает текстовое представление ошибки.
+func (e ErrTooManyRequests) Error() string {
+	return fmt.Sprintf("too many requests to accrual system, retry after %s", e.RetryAfter)
+}
+
+var (
+	ErrOrderNotRegistered = errors.New("order is not registered in accrual system") // ErrOrderNotRegistered представляет ошибку, возникающую, когда система начисления ещё не знает о заказе.
+	ErrAccrualUnavailable = errors.New("accrual system is unavailable")             // ErrAccrualUnavailable представляет временную ошибку на стороне системы начисления.
+	ErrNoAccrualProvider  = errors.New("no accrual provider for order")             // ErrNoAccrualProvider представляет ошибку, возникающую, когда заказ не относится ни к одной системе начисления.
+	ErrInvalidResponse    = errors.New("invalid accrual system response")           // ErrInvalidResponse представляет ошибку, возникающую, когда ответ системы начисления нарушает протокол.
+	ErrCircuitOpen        = errors.New("accrual system circuit breaker is open")    // ErrCircuitOpen представляет ошибку, возникающую, когда запросы к недоступной системе начисления временно не выполняются.
+)
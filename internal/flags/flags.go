@@ -4,10 +4,19 @@ import (
 	"flag"
 	"github.com/ZnNr/Go-GopherMart.git/internal/models"
 	"os"
+	"strconv"
+	"time"
 )
 
 const (
-	defaultAddr string = "localhost:8080"
+	defaultAddr            string        = "localhost:8080"
+	defaultAccrualWorkers  int           = 4
+	defaultAccrualTimeout  time.Duration = 5 * time.Second
+	defaultAccrualRetries  int           = 2
+	defaultBreakerFailures int           = 5
+	defaultBreakerTimeout  time.Duration = 30 * time.Second
+	defaultQuarantineAfter int           = 10
+	defaultReconcileWindow time.Duration = 24 * time.Hour
 )
 
 // WithDatabase добавляет опцию для конфигурации строки подключения к базе данных.
@@ -20,6 +29,16 @@ func WithDatabase() models.Option {
 	}
 }
 
+// WithMigrations добавляет опцию, включающую применение миграций схемы базы данных при запуске сервиса.
+func WithMigrations() models.Option {
+	return func(p *models.Config) {
+		flag.BoolVar(&p.Database.Migrate, "migrate", true, "apply database schema migrations on start")
+		if envMigrate, err := strconv.ParseBool(os.Getenv("DATABASE_MIGRATE")); err == nil {
+			p.Database.Migrate = envMigrate
+		}
+	}
+}
+
 // WithAddr добавляет опцию для конфигурации адреса и порта сервера.
 func WithAddr() models.Option {
 	return func(p *models.Config) {
@@ -40,6 +59,146 @@ func WithAccrual() models.Option {
 	}
 }
 
+// WithAccrualWorkers добавляет опцию для конфигурации количества воркеров, опрашивающих систему начисления.
+func WithAccrualWorkers() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.AccrualSystem.Workers, "w", defaultAccrualWorkers, "number of workers polling accrual system")
+		if envWorkers, err := strconv.Atoi(os.Getenv("ACCRUAL_WORKERS")); err == nil {
+			p.AccrualSystem.Workers = envWorkers
+		}
+	}
+}
+
+// WithAccrualRateLimit добавляет опцию для конфигурации ограничения количества запросов к системе начисления в секунду.
+func WithAccrualRateLimit() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.AccrualSystem.RateLimit, "l", 0, "max requests per second to accrual system, 0 means unlimited")
+		if envRateLimit, err := strconv.Atoi(os.Getenv("ACCRUAL_RATE_LIMIT")); err == nil {
+			p.AccrualSystem.RateLimit = envRateLimit
+		}
+	}
+}
+
+// WithAccrualClient добавляет опции для конфигурации HTTP-клиента системы начисления: тайм-аута запроса и количества повторов.
+func WithAccrualClient() models.Option {
+	return func(p *models.Config) {
+		flag.DurationVar(&p.AccrualSystem.Timeout, "accrual-timeout", defaultAccrualTimeout, "timeout of a single request to accrual system")
+		if envTimeout, err := time.ParseDuration(os.Getenv("ACCRUAL_TIMEOUT")); err == nil {
+			p.AccrualSystem.Timeout = envTimeout
+		}
+		flag.IntVar(&p.AccrualSystem.Retries, "accrual-retries", defaultAccrualRetries, "number of retries of a request to accrual system on network errors and 5xx")
+		if envRetries, err := strconv.Atoi(os.Getenv("ACCRUAL_RETRIES")); err == nil {
+			p.AccrualSystem.Retries = envRetries
+		}
+	}
+}
+
+// WithAccrualTLS добавляет опции для конфигурации TLS запросов к системе начисления: пакета сертификатов
+// удостоверяющих центров и сертификата клиента для взаимной аутентификации.
+func WithAccrualTLS() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.AccrualSystem.CAFile, "accrual-ca-file", "", "PEM bundle of CA certificates trusted for accrual system, empty means system pool")
+		if envCAFile := os.Getenv("ACCRUAL_CA_FILE"); envCAFile != "" {
+			p.AccrualSystem.CAFile = envCAFile
+		}
+		flag.StringVar(&p.AccrualSystem.CertFile, "accrual-cert-file", "", "PEM client certificate for mutual TLS with accrual system")
+		if envCertFile := os.Getenv("ACCRUAL_CERT_FILE"); envCertFile != "" {
+			p.AccrualSystem.CertFile = envCertFile
+		}
+		flag.StringVar(&p.AccrualSystem.KeyFile, "accrual-key-file", "", "PEM client key for mutual TLS with accrual system")
+		if envKeyFile := os.Getenv("ACCRUAL_KEY_FILE"); envKeyFile != "" {
+			p.AccrualSystem.KeyFile = envKeyFile
+		}
+	}
+}
+
+// WithAccrualAuth добавляет опции для конфигурации аутентификации запросов к системе начисления:
+// статического токена и ключа HMAC-подписи.
+func WithAccrualAuth() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.AccrualSystem.AuthToken, "accrual-token", "", "bearer token of requests to accrual system")
+		if envToken := os.Getenv("ACCRUAL_TOKEN"); envToken != "" {
+			p.AccrualSystem.AuthToken = envToken
+		}
+		flag.StringVar(&p.AccrualSystem.SigningSecret, "accrual-signing-secret", "", "HMAC secret signing requests to accrual system, empty disables signing")
+		if envSecret := os.Getenv("ACCRUAL_SIGNING_SECRET"); envSecret != "" {
+			p.AccrualSystem.SigningSecret = envSecret
+		}
+	}
+}
+
+// WithAccrualProviders добавляет опцию для конфигурации систем начисления партнёров, выбираемых по префиксу номера заказа.
+func WithAccrualProviders() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.AccrualSystem.Providers, "accrual-providers", "", "partner accrual systems as prefix=address,prefix=address")
+		if envProviders := os.Getenv("ACCRUAL_PROVIDERS"); envProviders != "" {
+			p.AccrualSystem.Providers = envProviders
+		}
+	}
+}
+
+// WithAccrualBreaker добавляет опции для конфигурации автоматического выключателя запросов к системе начисления.
+func WithAccrualBreaker() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.AccrualSystem.BreakerFailures, "accrual-breaker-failures", defaultBreakerFailures, "consecutive accrual system failures that open the circuit breaker")
+		if envFailures, err := strconv.Atoi(os.Getenv("ACCRUAL_BREAKER_FAILURES")); err == nil {
+			p.AccrualSystem.BreakerFailures = envFailures
+		}
+		flag.DurationVar(&p.AccrualSystem.BreakerTimeout, "accrual-breaker-timeout", defaultBreakerTimeout, "time before an open circuit breaker probes accrual system")
+		if envTimeout, err := time.ParseDuration(os.Getenv("ACCRUAL_BREAKER_TIMEOUT")); err == nil {
+			p.AccrualSystem.BreakerTimeout = envTimeout
+		}
+	}
+}
+
+// WithAccrualCallback добавляет опцию для конфигурации ключа подписи обратных вызовов системы начисления.
+func WithAccrualCallback() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.AccrualSystem.CallbackSecret, "accrual-callback-secret", "", "shared secret of accrual system callbacks, empty disables callbacks")
+		if envSecret := os.Getenv("ACCRUAL_CALLBACK_SECRET"); envSecret != "" {
+			p.AccrualSystem.CallbackSecret = envSecret
+		}
+	}
+}
+
+// WithAccrualQuarantine добавляет опцию для конфигурации количества ошибок опроса заказа подряд до его карантина.
+func WithAccrualQuarantine() models.Option {
+	return func(p *models.Config) {
+		flag.IntVar(&p.AccrualSystem.QuarantineAfter, "accrual-quarantine-after", defaultQuarantineAfter, "consecutive poll failures after which an order is quarantined")
+		if envFailures, err := strconv.Atoi(os.Getenv("ACCRUAL_QUARANTINE_AFTER")); err == nil {
+			p.AccrualSystem.QuarantineAfter = envFailures
+		}
+	}
+}
+
+// WithAdminToken добавляет опцию для конфигурации токена доступа к административным маршрутам.
+func WithAdminToken() models.Option {
+	return func(p *models.Config) {
+		flag.StringVar(&p.Server.AdminToken, "admin-token", "", "token of admin routes, empty disables them")
+		if envToken := os.Getenv("ADMIN_TOKEN"); envToken != "" {
+			p.Server.AdminToken = envToken
+		}
+	}
+}
+
+// WithReconcile добавляет опции для конфигурации периодической сверки начислений с системой начисления.
+func WithReconcile() models.Option {
+	return func(p *models.Config) {
+		flag.DurationVar(&p.Reconcile.Interval, "reconcile-interval", 0, "period of accrual reconciliation, 0 disables it")
+		if envInterval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil {
+			p.Reconcile.Interval = envInterval
+		}
+		flag.DurationVar(&p.Reconcile.Window, "reconcile-window", defaultReconcileWindow, "reconcile orders uploaded within this window")
+		if envWindow, err := time.ParseDuration(os.Getenv("RECONCILE_WINDOW")); err == nil {
+			p.Reconcile.Window = envWindow
+		}
+		flag.BoolVar(&p.Reconcile.Apply, "reconcile-apply", false, "adjust accruals of found discrepancies")
+		if envApply, err := strconv.ParseBool(os.Getenv("RECONCILE_APPLY")); err == nil {
+			p.Reconcile.Apply = envApply
+		}
+	}
+}
+
 // Init инициализирует конфигурацию с заданными опциями.
 func Init(opts ...models.Option) *models.Config {
 	p := &models.Config{}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// GetQuarantinedOrdersHandler обрабатывает запрос на получение заказов в карантине.
+func (h *AdminHandler) GetQuarantinedOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	orders, err := h.db.GetQuarantinedOrders()
+	if err != nil {
+		if errors.Is(err, errors2.ErrNoData) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.log.Errorf("error while getting quarantined orders from db: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(orders)
+}
+
+// GetQuarantinedOrderHandler обрабатывает запрос на получение заказа в карантине с ошибкой, из-за которой он туда попал.
+func (h *AdminHandler) GetQuarantinedOrderHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	orderID := chi.URLParam(r, "number")
+	order, err := h.db.GetQuarantinedOrder(orderID)
+	if err != nil {
+		if errors.Is(err, errors2.ErrNoData) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.log.Errorf("error while getting quarantined order %q from db: %s", orderID, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(order)
+}
+
+// RequeueOrderHandler обрабатывает запрос на возврат заказа из карантина в опрос.
+func (h *AdminHandler) RequeueOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID := chi.URLParam(r, "number")
+	if err := h.db.RequeueOrder(orderID); err != nil {
+		if errors.Is(err, errors2.ErrNoData) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.log.Errorf("error while requeueing order %q: %s", orderID, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.log.Infof("order %q is requeued from quarantine", orderID)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// AuthenticateAdmin пропускает только запросы с токеном администратора в заголовке Authorization.
+func (h *AdminHandler) AuthenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+			h.log.Error("invalid admin token")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewAdmin создает обработчик административных запросов, доступных по токену token.
+func NewAdmin(db AdminDBManager, token []byte, log *zap.SugaredLogger) *AdminHandler {
+	return &AdminHandler{
+		db:    db,
+		token: token,
+		log:   log,
+	}
+}
+
+// AdminHandler обрабатывает административные запросы операторов сервиса.
+type AdminHandler struct {
+	db    AdminDBManager
+	token []byte
+	log   *zap.SugaredLogger
+}
+
+type AdminDBManager interface {
+	GetQuarantinedOrders() ([]byte, error)
+	GetQuarantinedOrder(orderID string) ([]byte, error)
+	RequeueOrder(orderID string) error
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeAdminDBManager хранит заказы в карантине в памяти.
+type fakeAdminDBManager struct {
+	quarantined map[string]string
+}
+
+func (f *fakeAdminDBManager) GetQuarantinedOrders() ([]byte, error) {
+	if len(f.quarantined) == 0 {
+		return nil, errors2.ErrNoData
+	}
+	return []byte(`[]`), nil
+}
+
+func (f *fakeAdminDBManager) GetQuarantinedOrder(orderID string) ([]byte, error) {
+	order, ok := f.quarantined[orderID]
+	if !ok {
+		return nil, errors2.ErrNoData
+	}
+	return []byte(order), nil
+}
+
+func (f *fakeAdminDBManager) RequeueOrder(orderID string) error {
+	if _, ok := f.quarantined[orderID]; !ok {
+		return errors2.ErrNoData
+	}
+	delete(f.quarantined, orderID)
+	return nil
+}
+
+func TestAdminHandler(t *testing.T) {
+	db := &fakeAdminDBManager{quarantined: map[string]string{"100500": `{"number":"100500","last_error":"some error"}`}}
+	handler := NewAdmin(db, []byte("admin-token"), zap.NewNop().Sugar())
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(handler.AuthenticateAdmin)
+		r.Get("/api/internal/quarantine", handler.GetQuarantinedOrdersHandler)
+		r.Get("/api/internal/quarantine/{number}", handler.GetQuarantinedOrderHandler)
+		r.Post("/api/internal/quarantine/{number}/requeue", handler.RequeueOrderHandler)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{
+			name:   "negative: no token",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "negative: wrong token",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine",
+			token:  "user-token",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "positive: list",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine",
+			token:  "admin-token",
+			status: http.StatusOK,
+		},
+		{
+			name:   "positive: inspect",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine/100500",
+			token:  "admin-token",
+			status: http.StatusOK,
+			body:   `{"number":"100500","last_error":"some error"}`,
+		},
+		{
+			name:   "negative: inspect unknown order",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine/100501",
+			token:  "admin-token",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "positive: requeue",
+			method: http.MethodPost,
+			path:   "/api/internal/quarantine/100500/requeue",
+			token:  "admin-token",
+			status: http.StatusAccepted,
+		},
+		{
+			name:   "negative: requeue twice",
+			method: http.MethodPost,
+			path:   "/api/internal/quarantine/100500/requeue",
+			token:  "admin-token",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "positive: empty list",
+			method: http.MethodGet,
+			path:   "/api/internal/quarantine",
+			token:  "admin-token",
+			status: http.StatusNoContent,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := resty.New().R()
+			if tc.token != "" {
+				request.SetAuthToken(tc.token)
+			}
+			response, err := request.Execute(tc.method, fmt.Sprintf("%s%s", srv.URL, tc.path))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, response.StatusCode())
+			if tc.body != "" {
+				assert.JSONEq(t, tc.body, string(response.Body()))
+			}
+		})
+	}
+}
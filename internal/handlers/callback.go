@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// signatureHeader это заголовок с HMAC-SHA256 подписью обратного вызова в виде "sha256=<hex>".
+	signatureHeader = "X-Signature"
+	// timestampHeader это заголовок с отметкой времени подписи в секундах Unix.
+	timestampHeader = "X-Timestamp"
+	// maxCallbackBodySize это максимальный размер тела обратного вызова.
+	maxCallbackBodySize = 1 << 20
+	// callbackTimestampSkew это допустимое расхождение отметки времени подписи с текущим временем:
+	// перехваченный обратный вызов нельзя повторить позже этого окна.
+	callbackTimestampSkew = 5 * time.Minute
+)
+
+// CallbackHandler обрабатывает обратный вызов системы начисления с информацией о заказе.
+func (h *CallbackHandler) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(http.MaxBytesReader(w, r.Body, maxCallbackBodySize)); err != nil {
+		h.log.Errorf("error while reading request body: %s", err.Error())
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Проверяем, что обратный вызов свежий и подписан общим секретом
+	timestamp := r.Header.Get(timestampHeader)
+	if !checkTimestamp(timestamp, time.Now()) {
+		h.log.Errorf("invalid accrual callback timestamp %q", timestamp)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !h.checkSignature(timestamp, body.Bytes(), r.Header.Get(signatureHeader)) {
+		h.log.Error("invalid accrual callback signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var orderInfo models.OrderInfo
+	if err := json.Unmarshal(body.Bytes(), &orderInfo); err != nil {
+		h.log.Errorf("error while unmarshalling request body: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Номер заказа может прийти как в поле number, так и в поле order
+	if orderInfo.OrderID == "" && orderInfo.Order != nil {
+		orderInfo.OrderID = *orderInfo.Order
+	}
+	orderInfo.Order = &orderInfo.OrderID
+	// Обратный вызов проверяется по тем же правилам, что и ответы на опрос системы начисления
+	if err := models.ValidateOrderInfo(orderInfo.OrderID, &orderInfo); err != nil {
+		h.violations.Add(1)
+		h.log.Warnf("invalid accrual callback: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Применяем информацию о заказе с проверкой допустимости перехода статуса
+	if err := h.db.ApplyCallback(&orderInfo); err != nil {
+		if errors.Is(err, errors2.ErrForbiddenTransition) {
+			h.log.Warnf("rejected accrual callback: %s", err.Error())
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		h.log.Errorf("error while applying accrual callback: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	h.log.Infof("order %q updated by accrual callback with status %s", orderInfo.OrderID, orderInfo.Status)
+}
+
+// Violations возвращает количество обратных вызовов системы начисления, нарушивших протокол.
+func (h *CallbackHandler) Violations() int64 {
+	return h.violations.Load()
+}
+
+// checkTimestamp проверяет, что отметка времени подписи timestamp отличается от now не больше чем на callbackTimestampSkew.
+func checkTimestamp(timestamp string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	return skew <= callbackTimestampSkew && skew >= -callbackTimestampSkew
+}
+
+// checkSignature проверяет подпись отметки времени и тела запроса.
+func (h *CallbackHandler) checkSignature(timestamp string, body []byte, signature string) bool {
+	signature, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, Sign(h.secret, timestamp, body))
+}
+
+// Sign возвращает HMAC-SHA256 подпись обратного вызова ключом secret.
+// Подписывается отметка времени timestamp и тело body, разделённые переводом строки.
+func Sign(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// NewCallback создает обработчик обратных вызовов системы начисления, подписанных ключом secret.
+func NewCallback(db CallbackDBManager, secret []byte, log *zap.SugaredLogger) *CallbackHandler {
+	return &CallbackHandler{
+		db:     db,
+		secret: secret,
+		log:    log,
+	}
+}
+
+// CallbackHandler принимает информацию о заказах, которую система начисления присылает сама.
+type CallbackHandler struct {
+	db     CallbackDBManager
+	secret []byte
+	log    *zap.SugaredLogger
+	// violations это количество обратных вызовов, нарушивших протокол.
+	violations atomic.Int64
+}
+
+type CallbackDBManager interface {
+	ApplyCallback(orderInfo *models.OrderInfo) error
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCallbackDBManager запоминает применённые обратные вызовы и отвечает ошибкой err.
+type fakeCallbackDBManager struct {
+	applied []models.OrderInfo
+	err     error
+}
+
+func (f *fakeCallbackDBManager) ApplyCallback(orderInfo *models.OrderInfo) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.applied = append(f.applied, *orderInfo)
+	return nil
+}
+
+func TestCallbackHandler(t *testing.T) {
+	secret := []byte("secret")
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	sign := func(timestamp string, body string) string {
+		return "sha256=" + hex.EncodeToString(Sign(secret, timestamp, []byte(body)))
+	}
+	largeBody := `{"number":"100500","status":"PROCESSED","accrual":500,"padding":"` + strings.Repeat("a", maxCallbackBodySize) + `"}`
+	testCases := []struct {
+		name       string
+		body       string
+		timestamp  string
+		signature  string
+		dbErr      error
+		status     int
+		applied    int
+		violations int64
+	}{
+		{
+			name:      "positive",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			timestamp: now,
+			signature: sign(now, `{"number":"100500","status":"PROCESSED","accrual":500}`),
+			status:    http.StatusOK,
+			applied:   1,
+		},
+		{
+			name:      "positive: order field",
+			body:      `{"order":"100500","status":"INVALID"}`,
+			timestamp: now,
+			signature: sign(now, `{"order":"100500","status":"INVALID"}`),
+			status:    http.StatusOK,
+			applied:   1,
+		},
+		{
+			name:      "negative: wrong signature",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			timestamp: now,
+			signature: sign(now, `{"number":"100500","status":"PROCESSED","accrual":5000}`),
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "negative: no signature",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			timestamp: now,
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "negative: no timestamp",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			signature: sign("", `{"number":"100500","status":"PROCESSED","accrual":500}`),
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "negative: stale timestamp",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			timestamp: stale,
+			signature: sign(stale, `{"number":"100500","status":"PROCESSED","accrual":500}`),
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "negative: timestamp not signed",
+			body:      `{"number":"100500","status":"PROCESSED","accrual":500}`,
+			timestamp: now,
+			signature: sign(stale, `{"number":"100500","status":"PROCESSED","accrual":500}`),
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "negative: body too large",
+			body:      largeBody,
+			timestamp: now,
+			signature: sign(now, largeBody),
+			status:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "negative: unknown status",
+			body:       `{"number":"100500","status":"DONE"}`,
+			timestamp:  now,
+			signature:  sign(now, `{"number":"100500","status":"DONE"}`),
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:       "negative: accrual of processing order",
+			body:       `{"number":"100500","status":"PROCESSING","accrual":500}`,
+			timestamp:  now,
+			signature:  sign(now, `{"number":"100500","status":"PROCESSING","accrual":500}`),
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:       "negative: no order",
+			body:       `{"status":"PROCESSED","accrual":500}`,
+			timestamp:  now,
+			signature:  sign(now, `{"status":"PROCESSED","accrual":500}`),
+			status:     http.StatusBadRequest,
+			violations: 1,
+		},
+		{
+			name:      "negative: forbidden transition",
+			body:      `{"number":"100500","status":"PROCESSING"}`,
+			timestamp: now,
+			signature: sign(now, `{"number":"100500","status":"PROCESSING"}`),
+			dbErr:     errors2.ErrForbiddenTransition,
+			status:    http.StatusConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeCallbackDBManager{err: tc.dbErr}
+			handler := NewCallback(db, secret, zap.NewNop().Sugar())
+			r := chi.NewRouter()
+			r.Post("/api/internal/accrual/callback", handler.CallbackHandler)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			response, err := resty.New().R().
+				SetHeader("X-Timestamp", tc.timestamp).
+				SetHeader("X-Signature", tc.signature).
+				SetBody(tc.body).
+				Post(fmt.Sprintf("%s/api/internal/accrual/callback", srv.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, response.StatusCode())
+			assert.Len(t, db.applied, tc.applied)
+			assert.Equal(t, tc.violations, handler.Violations())
+			if tc.applied > 0 {
+				assert.Equal(t, "100500", *db.applied[0].Order)
+			}
+		})
+	}
+}
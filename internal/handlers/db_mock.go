@@ -2,7 +2,10 @@
 
 package handlers
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	models "github.com/ZnNr/Go-GopherMart.git/internal/models"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // mockDbManager is an autogenerated mock type for the DBManager type
 type mockDbManager struct {
@@ -39,6 +42,36 @@ func (_m *mockDbManager) GetBalanceInfo(login string) ([]byte, error) {
 	return r0, r1
 }
 
+// GetOrderHistory provides a mock function with given fields: login, orderID
+func (_m *mockDbManager) GetOrderHistory(login string, orderID string) ([]byte, error) {
+	ret := _m.Called(login, orderID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOrderHistory")
+	}
+
+	var r0 []byte
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) ([]byte, error)); ok {
+		return rf(login, orderID)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) []byte); ok {
+		r0 = rf(login, orderID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(login, orderID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserOrders provides a mock function with given fields: login
 func (_m *mockDbManager) GetUserOrders(login string) ([]byte, error) {
 	ret := _m.Called(login)
@@ -154,7 +187,7 @@ func (_m *mockDbManager) Register(login string, password string) error {
 }
 
 // Withdraw provides a mock function with given fields: login, orderID, sum
-func (_m *mockDbManager) Withdraw(login string, orderID string, sum float64) error {
+func (_m *mockDbManager) Withdraw(login string, orderID string, sum models.Money) error {
 	ret := _m.Called(login, orderID, sum)
 
 	if len(ret) == 0 {
@@ -162,7 +195,7 @@ func (_m *mockDbManager) Withdraw(login string, orderID string, sum float64) err
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(string, string, float64) error); ok {
+	if rf, ok := ret.Get(0).(func(string, string, models.Money) error); ok {
 		r0 = rf(login, orderID, sum)
 	} else {
 		r0 = ret.Error(0)
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
 	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v4"
 	"go.uber.org/zap"
 	"net/http"
@@ -90,11 +91,16 @@ func (h *Handler) WithdrawHandler(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusPaymentRequired)
 			return
 		}
-		h.log.Errorf("error while trying to withdraw %f from user %q: %s", withdrawInfo.Amount, login, err.Error())
+		if errors.Is(err, errors2.ErrInvalidAmount) {
+			h.log.Errorf("invalid withdraw sum %s", withdrawInfo.Amount)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		h.log.Errorf("error while trying to withdraw %s from user %q: %s", withdrawInfo.Amount, login, err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	h.log.Infof("withdrawn %f from user %q for order %q", withdrawInfo.Amount, login, withdrawInfo.OrderID)
+	h.log.Infof("withdrawn %s from user %q for order %q", withdrawInfo.Amount, login, withdrawInfo.OrderID)
 }
 
 // GetOrdersHandler обрабатывает запрос на получение заказов пользователя.
@@ -120,6 +126,30 @@ func (h *Handler) GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(userOrders)
 }
 
+// GetOrderHistoryHandler обрабатывает запрос на получение истории статусов заказа пользователя.
+func (h *Handler) GetOrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	// Получаем логин пользователя из токена и проверяем статус
+	login, status := h.getUsernameFromTokenAndExtractClaims(r)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	// Получение истории заказа пользователя из базы данных
+	orderID := chi.URLParam(r, "number")
+	history, err := h.db.GetOrderHistory(login, orderID)
+	if err != nil {
+		if errors.Is(err, errors2.ErrNoData) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.log.Errorf("error while getting order history from db: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(history)
+}
+
 // LoadOrderHandler обрабатывает запрос на загрузку заказа.
 func (h *Handler) LoadOrderHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "text/plain")
@@ -387,13 +417,14 @@ type Handler struct {
 //
 //go:generate mockery --disable-version-string --filename db_mock.go --inpackage --name dbManager
 type DBManager interface {
-	GetBalanceInfo(login string) ([]byte, error)              // GetBalanceInfo возвращает информацию о балансе пользователя по его логину.
-	GetWithdrawals(login string) ([]byte, error)              // GetWithdrawals возвращает список выводов пользователя по его логину.
-	Withdraw(login string, orderID string, sum float64) error // Withdraw осуществляет вывод средств для заданного пользователя, заказа и суммы.
-	GetUserOrders(login string) ([]byte, error)               // GetUserOrders возвращает список заказов пользователя по его логину.
-	LoadOrder(login string, orderID string) error             // LoadOrder загружает информацию о заданном заказе пользователя по его логину и идентификатору заказа.
-	Register(login string, password string) error             // Register регистрирует нового пользователя с заданным логином и паролем.
-	Login(login string, password string) error                // Login выполняет вход пользователя с заданным логином и паролем.
+	GetBalanceInfo(login string) ([]byte, error)                   // GetBalanceInfo возвращает информацию о балансе пользователя по его логину.
+	GetWithdrawals(login string) ([]byte, error)                   // GetWithdrawals возвращает список выводов пользователя по его логину.
+	Withdraw(login string, orderID string, sum models.Money) error // Withdraw осуществляет вывод средств для заданного пользователя, заказа и суммы.
+	GetUserOrders(login string) ([]byte, error)                    // GetUserOrders возвращает список заказов пользователя по его логину.
+	GetOrderHistory(login string, orderID string) ([]byte, error)  // GetOrderHistory возвращает историю статусов заказа пользователя.
+	LoadOrder(login string, orderID string) error                  // LoadOrder загружает информацию о заданном заказе пользователя по его логину и идентификатору заказа.
+	Register(login string, password string) error                  // Register регистрирует нового пользователя с заданным логином и паролем.
+	Login(login string, password string) error                     // Login выполняет вход пользователя с заданным логином и паролем.
 }
 
 // createToken создает токен аутентификации для заданного пользователя и времени истечения срока действия.
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
 	"github.com/stretchr/testify/assert"
@@ -409,6 +410,71 @@ func TestHandler_GetOrders(t *testing.T) {
 	})
 }
 
+func TestHandler_GetOrderHistory(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	log := *logger.Sugar()
+
+	testCases := []struct {
+		name           string
+		history        []byte
+		errDB          error
+		expectedStatus string
+	}{
+		{
+			name:           "positive: success",
+			history:        []byte(`[{"status":"NEW","accrual":0,"changed_at":"2021-08-15T14:30:45+03:00"},{"status":"PROCESSED","accrual":100.5,"changed_at":"2021-08-15T14:31:45+03:00"}]`),
+			expectedStatus: "200 OK",
+		},
+		{
+			name:           "negative: not found",
+			errDB:          errors2.ErrNoData,
+			expectedStatus: "404 Not Found",
+		},
+		{
+			name:           "negative: db error",
+			errDB:          errors.New("some error"),
+			expectedStatus: "500 Internal Server Error",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manager := newMockDbManager(t)
+			manager.On("Register", "test", "test").Return(nil)
+			manager.On("Login", "test", "test").Return(nil)
+			manager.On("GetOrderHistory", "test", "100500").Return(tc.history, tc.errDB)
+
+			handler := New(manager, &log)
+			r := chi.NewRouter()
+			r.Post("/api/user/register", handler.RegisterHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(handler.AuthenticateRequest)
+				r.Get("/api/user/orders/{number}/history", handler.GetOrderHistoryHandler)
+			})
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			user, err := resty.New().R().
+				SetHeader("Content-Type", "text/plain").SetBody(`{"login": "test", "password": "test"}`).
+				Post(fmt.Sprintf("%s/api/user/register", srv.URL))
+			assert.NoError(t, err)
+
+			response, err := resty.New().R().
+				SetHeader("Authorization", user.Header().Get("Authorization")).
+				Get(fmt.Sprintf("%s/api/user/orders/100500/history", srv.URL))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedStatus, response.Status())
+			if tc.history != nil {
+				assert.JSONEq(t, string(tc.history), string(response.Body()))
+			}
+		})
+	}
+}
+
 func TestHandler_Withdraw(t *testing.T) {
 	logger, err := zap.NewDevelopment()
 	if err != nil {
@@ -421,7 +487,7 @@ func TestHandler_Withdraw(t *testing.T) {
 		name           string
 		balance        float64
 		order          string
-		withdraw       float64
+		withdraw       models.Money
 		expectedStatus string
 		errDB          error
 	}{
@@ -429,14 +495,14 @@ func TestHandler_Withdraw(t *testing.T) {
 			name:           "positive: success withdraw",
 			order:          "2377225624",
 			balance:        55,
-			withdraw:       20,
+			withdraw:       2000,
 			expectedStatus: "200 OK",
 		},
 		{
 			name:           "negative: insufficient balance",
 			order:          "2377225624",
 			balance:        20,
-			withdraw:       55,
+			withdraw:       5500,
 			expectedStatus: "402 Payment Required",
 			errDB:          errors2.ErrInsufficientBalance,
 		},
@@ -444,8 +510,16 @@ func TestHandler_Withdraw(t *testing.T) {
 			name:           "negative: bad order num",
 			order:          "123",
 			balance:        55,
-			withdraw:       20,
+			withdraw:       2000,
+			expectedStatus: "422 Unprocessable Entity",
+		},
+		{
+			name:           "negative: non-positive sum",
+			order:          "2377225624",
+			balance:        55,
+			withdraw:       0,
 			expectedStatus: "422 Unprocessable Entity",
+			errDB:          errors2.ErrInvalidAmount,
 		},
 	}
 	for _, tt := range testCases {
@@ -453,7 +527,7 @@ func TestHandler_Withdraw(t *testing.T) {
 			manager := newMockDbManager(t)
 			manager.On("Register", "test", "test").Return(nil)
 			manager.On("Login", "test", "test").Return(nil)
-			if tt.expectedStatus != "422 Unprocessable Entity" {
+			if tt.expectedStatus != "422 Unprocessable Entity" || tt.errDB != nil {
 				manager.On("Withdraw", "test", tt.order, tt.withdraw).Return(tt.errDB)
 			}
 
@@ -477,7 +551,7 @@ func TestHandler_Withdraw(t *testing.T) {
 
 			response, err := resty.New().R().
 				SetHeader("Authorization", user.Header().Get("Authorization")).
-				SetBody(fmt.Sprintf(`{"order": %q, "sum": %f}`, tt.order, tt.withdraw)).
+				SetBody(fmt.Sprintf(`{"order": %q, "sum": %s}`, tt.order, tt.withdraw)).
 				Post(fmt.Sprintf("%s/api/user/balance/withdraw", srv.URL))
 
 			assert.NoError(t, err)
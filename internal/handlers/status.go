@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// StatusHandler обрабатывает запрос на получение состояния фоновых компонентов сервиса.
+func (h *StatusHandler) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	status := make(map[string]any, len(h.sources))
+	for name, source := range h.sources {
+		status[name] = source()
+	}
+	result, err := json.Marshal(status)
+	if err != nil {
+		h.log.Errorf("error while marshalling service status: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(result)
+}
+
+// NewStatus создает обработчик состояния; sources сопоставляет имени компонента функцию, возвращающую его состояние.
+func NewStatus(sources map[string]func() any, log *zap.SugaredLogger) *StatusHandler {
+	return &StatusHandler{
+		sources: sources,
+		log:     log,
+	}
+}
+
+// StatusHandler отдаёт операторам состояние фоновых компонентов сервиса.
+type StatusHandler struct {
+	sources map[string]func() any
+	log     *zap.SugaredLogger
+}
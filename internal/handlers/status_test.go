@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	handler := NewStatus(map[string]func() any{
+		"leader":        func() any { return true },
+		"orders_poller": func() any { return map[string]string{"state": "running"} },
+	}, zap.NewNop().Sugar())
+	r := chi.NewRouter()
+	r.Get("/api/internal/status", handler.StatusHandler)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	response, err := resty.New().R().Get(fmt.Sprintf("%s/api/internal/status", srv.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, response.Status(), "200 OK")
+	assert.JSONEq(t, `{"leader":true,"orders_poller":{"state":"running"}}`, string(response.Body()))
+}
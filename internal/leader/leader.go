@@ -0,0 +1,129 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRetryInterval = 5 * time.Second // defaultRetryInterval это пауза между попытками стать лидером.
+	defaultCheckInterval = 5 * time.Second // defaultCheckInterval это период проверки соединения, удерживающего блокировку.
+	unlockTimeout        = 5 * time.Second // unlockTimeout это время на снятие блокировки при передаче лидерства.
+)
+
+// Run пытается стать лидером и, пока лидерство удерживается, выполняет fn.
+// Контекст fn отменяется при потере соединения с базой данных или при отмене ctx; после завершения fn
+// блокировка снимается, чтобы лидерство перешло к другому экземпляру. Run возвращается после отмены ctx.
+func (e *Elector) Run(ctx context.Context, fn func(ctx context.Context)) {
+	for {
+		if err := e.lead(ctx, fn); err != nil && ctx.Err() == nil {
+			e.log.Errorf("error while holding leadership: %s", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retryInterval):
+		}
+	}
+}
+
+// IsLeader сообщает, является ли текущий экземпляр лидером.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// lead выполняет одну попытку захватить блокировку и удерживает её, пока она действительна.
+func (e *Elector) lead(ctx context.Context, fn func(ctx context.Context)) error {
+	// Advisory-блокировка принадлежит сессии, поэтому всё время лидерства держим одно соединение.
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error while getting connection for leader election: %w", err)
+	}
+	defer conn.Close()
+
+	var acquired bool
+	if err = conn.QueryRowContext(ctx, `select pg_try_advisory_lock($1)`, e.key).Scan(&acquired); err != nil {
+		return fmt.Errorf("error while trying to acquire advisory lock: %w", err)
+	}
+	if !acquired {
+		return nil
+	}
+	e.leading.Store(true)
+	e.log.Infof("became leader for background jobs")
+
+	jobsCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(jobsCtx)
+	}()
+	// Проверяем, что соединение с блокировкой живо, пока не отменён контекст или не завершились задачи.
+	lost := e.hold(ctx, conn, done)
+	cancel()
+	<-done
+	e.leading.Store(false)
+
+	if lost != nil {
+		e.discard(conn)
+		return fmt.Errorf("leadership lost: %w", lost)
+	}
+	e.log.Infof("stepping down from leadership")
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer unlockCancel()
+	if _, err = conn.ExecContext(unlockCtx, `select pg_advisory_unlock($1)`, e.key); err != nil {
+		e.discard(conn)
+		return fmt.Errorf("error while releasing advisory lock: %w", err)
+	}
+	return nil
+}
+
+// hold периодически проверяет соединение, удерживающее блокировку. Возвращает ошибку, если соединение потеряно.
+func (e *Elector) hold(ctx context.Context, conn *sql.Conn, done <-chan struct{}) error {
+	ticker := time.NewTicker(e.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+			if _, err := conn.ExecContext(ctx, `select 1`); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
+}
+
+// discard закрывает соединение, не возвращая его в пул, чтобы вместе с сессией гарантированно снялась блокировка.
+func (e *Elector) discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+}
+
+// New создает Elector, выбирающий лидера среди экземпляров сервиса с помощью advisory-блокировки с ключом key.
+func New(db *sql.DB, key int64, log *zap.SugaredLogger) *Elector {
+	return &Elector{
+		db:            db,
+		key:           key,
+		log:           log,
+		retryInterval: defaultRetryInterval,
+		checkInterval: defaultCheckInterval,
+	}
+}
+
+// Elector выбирает единственного экземпляра сервиса, на котором выполняются фоновые задачи.
+type Elector struct {
+	db            *sql.DB
+	key           int64
+	log           *zap.SugaredLogger
+	retryInterval time.Duration
+	checkInterval time.Duration
+	leading       atomic.Bool
+}
@@ -0,0 +1,86 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestElector_Run(t *testing.T) {
+	t.Run("positive: leader runs jobs and releases lock on shutdown", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(`select pg_try_advisory_lock($1)`)).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+		mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(int64(42)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		e := New(db, 42, zap.NewNop().Sugar())
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		go func() {
+			<-started
+			assert.True(t, e.IsLeader())
+			cancel()
+		}()
+		e.Run(ctx, func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+		})
+		assert.False(t, e.IsLeader())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("negative: lock is held by another instance", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(`select pg_try_advisory_lock($1)`)).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+		e := New(db, 42, zap.NewNop().Sugar())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		called := false
+		e.Run(ctx, func(ctx context.Context) {
+			called = true
+		})
+		assert.False(t, called)
+		assert.False(t, e.IsLeader())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("negative: connection with lock is lost", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta(`select pg_try_advisory_lock($1)`)).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+		mock.ExpectExec(regexp.QuoteMeta(`select 1`)).WillReturnError(errors.New("connection reset"))
+
+		e := New(db, 42, zap.NewNop().Sugar())
+		e.checkInterval = 10 * time.Millisecond
+		stopped := make(chan struct{})
+		err = e.lead(context.Background(), func(ctx context.Context) {
+			<-ctx.Done()
+			close(stopped)
+		})
+		assert.ErrorContains(t, err, "leadership lost")
+		assert.False(t, e.IsLeader())
+		<-stopped
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
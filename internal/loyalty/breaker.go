@@ -0,0 +1,156 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// BreakerState представляет состояние автоматического выключателя.
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // BreakerClosed запросы выполняются как обычно.
+	BreakerOpen     BreakerState = "open"      // BreakerOpen система начисления недоступна, запросы не выполняются.
+	BreakerHalfOpen BreakerState = "half_open" // BreakerHalfOpen выполняются пробные запросы, чтобы проверить, восстановилась ли система начисления.
+)
+
+// BreakerConfig содержит настройки автоматического выключателя.
+type BreakerConfig struct {
+	FailureThreshold int           // FailureThreshold это количество отказов подряд, после которого выключатель размыкается.
+	OpenTimeout      time.Duration // OpenTimeout это время, через которое разомкнутый выключатель пропускает пробный запрос.
+	HalfOpenProbes   int           // HalfOpenProbes это количество одновременных пробных запросов.
+}
+
+// DefaultBreakerConfig возвращает настройки автоматического выключателя по умолчанию.
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenProbes:   1,
+	}
+}
+
+// BreakerStatus содержит информацию о состоянии автоматического выключателя.
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`                // State это текущее состояние выключателя.
+	ConsecutiveFailures int          `json:"consecutive_failures"` // ConsecutiveFailures это количество отказов подряд.
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`  // OpenedAt это время последнего размыкания.
+	ProbeAt             *time.Time   `json:"probe_at,omitempty"`   // ProbeAt это время, начиная с которого будет выполнен пробный запрос.
+}
+
+// GetOrderInfo запрашивает информацию о заказе, если выключатель замкнут или пропускает пробный запрос.
+// Пока выключатель разомкнут, сразу возвращает ErrCircuitOpen.
+func (b *CircuitBreaker) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	info, err := b.provider.GetOrderInfo(ctx, orderID)
+	b.record(err)
+	return info, err
+}
+
+// Status возвращает текущее состояние выключателя.
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state != BreakerClosed {
+		openedAt, probeAt := b.openedAt, b.probeAt
+		status.OpenedAt, status.ProbeAt = &openedAt, &probeAt
+	}
+	return status
+}
+
+// allow решает, можно ли выполнить запрос, и переводит разомкнутый выключатель в полуразомкнутый по истечении OpenTimeout.
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		if time.Now().Before(b.probeAt) {
+			return fmt.Errorf("%w: %s", errors2.ErrCircuitOpen, b.name)
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		b.log.Infof("circuit breaker %s is half-open, probing accrual system", b.name)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.cfg.HalfOpenProbes {
+			return fmt.Errorf("%w: %s", errors2.ErrCircuitOpen, b.name)
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// record учитывает результат запроса: отказы системы начисления размыкают выключатель,
+// любой её ответ замыкает его; отмена запроса вызывающей стороной не учитывается.
+func (b *CircuitBreaker) record(err error) {
+	failure := errors.Is(err, errors2.ErrAccrualUnavailable)
+	canceled := !failure && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probes--
+	}
+	switch {
+	case canceled:
+	case failure:
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+			b.open(err)
+		}
+	default:
+		if b.state == BreakerHalfOpen {
+			b.log.Infof("circuit breaker %s is closed, accrual system is available again", b.name)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+	}
+}
+
+// open размыкает выключатель; вызывается под b.mu.
+func (b *CircuitBreaker) open(err error) {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.probeAt = b.openedAt.Add(b.cfg.OpenTimeout)
+	b.log.Warnf("circuit breaker %s is open after %d consecutive failures, next probe at %s: %s",
+		b.name, b.failures, b.probeAt.Format(time.RFC3339), err.Error())
+}
+
+// NewCircuitBreaker создает автоматический выключатель name вокруг системы начисления provider.
+func NewCircuitBreaker(name string, provider AccrualProvider, cfg BreakerConfig, log *zap.SugaredLogger) *CircuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultBreakerConfig().FailureThreshold
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = DefaultBreakerConfig().HalfOpenProbes
+	}
+	return &CircuitBreaker{
+		name:     name,
+		provider: provider,
+		cfg:      cfg,
+		log:      log,
+		state:    BreakerClosed,
+	}
+}
+
+// CircuitBreaker реализует AccrualProvider и прекращает запросы к системе начисления, пока она недоступна.
+type CircuitBreaker struct {
+	name     string
+	provider AccrualProvider
+	cfg      BreakerConfig
+	log      *zap.SugaredLogger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int       // failures это количество отказов подряд.
+	probes   int       // probes это количество выполняющихся пробных запросов.
+	openedAt time.Time // openedAt это время последнего размыкания.
+	probeAt  time.Time // probeAt это время, начиная с которого разрешён пробный запрос.
+}
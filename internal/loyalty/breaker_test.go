@@ -0,0 +1,106 @@
+package loyalty
+
+import (
+	"context"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// flakyAccrualProvider отвечает ошибкой err и считает обращения.
+type flakyAccrualProvider struct {
+	err   error
+	calls int
+}
+
+func (f *flakyAccrualProvider) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.OrderInfo{OrderID: orderID, Order: &orderID, Status: models.OrderStatusProcessed}, nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	provider := &flakyAccrualProvider{err: fmt.Errorf("%w: status 503", errors2.ErrAccrualUnavailable)}
+	breaker := NewCircuitBreaker("test", provider, BreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}, zap.NewNop().Sugar())
+	ctx := context.Background()
+
+	// Отказы подряд размыкают выключатель
+	for i := 0; i < 2; i++ {
+		_, err := breaker.GetOrderInfo(ctx, "1")
+		assert.ErrorIs(t, err, errors2.ErrAccrualUnavailable)
+	}
+	assert.Equal(t, BreakerOpen, breaker.Status().State)
+	_, err := breaker.GetOrderInfo(ctx, "1")
+	assert.ErrorIs(t, err, errors2.ErrCircuitOpen)
+	assert.Equal(t, 2, provider.calls)
+
+	// Неудачный пробный запрос снова размыкает выключатель
+	time.Sleep(60 * time.Millisecond)
+	_, err = breaker.GetOrderInfo(ctx, "1")
+	assert.ErrorIs(t, err, errors2.ErrAccrualUnavailable)
+	assert.Equal(t, BreakerOpen, breaker.Status().State)
+	assert.Equal(t, 3, provider.calls)
+
+	// Удачный пробный запрос замыкает выключатель
+	time.Sleep(60 * time.Millisecond)
+	provider.err = nil
+	_, err = breaker.GetOrderInfo(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, BreakerStatus{State: BreakerClosed}, breaker.Status())
+}
+
+func TestCircuitBreaker_IgnoresOtherErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "not registered",
+			err:  errors2.ErrOrderNotRegistered,
+		},
+		{
+			name: "too many requests",
+			err:  errors2.ErrTooManyRequests{RetryAfter: time.Second},
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := &flakyAccrualProvider{err: tc.err}
+			breaker := NewCircuitBreaker("test", provider, BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, zap.NewNop().Sugar())
+			for i := 0; i < 3; i++ {
+				_, err := breaker.GetOrderInfo(context.Background(), "1")
+				assert.ErrorIs(t, err, tc.err)
+			}
+			assert.Equal(t, BreakerClosed, breaker.Status().State)
+		})
+	}
+}
+
+func TestLoyaltySystemManager_UpdateOrdersInfoWithOpenBreaker(t *testing.T) {
+	provider := &flakyAccrualProvider{err: errors2.ErrAccrualUnavailable}
+	breaker := NewCircuitBreaker("test", provider, BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, zap.NewNop().Sugar())
+	db := newFakeDBManager("1", "2", "3")
+	ls := New(breaker, db, zap.NewNop().Sugar())
+	assert.ErrorIs(t, ls.UpdateOrdersInfo(context.Background()), errors2.ErrAccrualUnavailable)
+	assert.Equal(t, 1, provider.calls)
+	// Отказ системы начисления и разомкнутый выключатель откладывают опрос заказов, не считая ошибками заказов
+	assert.Empty(t, db.failures)
+	assert.Empty(t, db.scheduled)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1, "3": 1}, db.deferred)
+
+	// Пока выключатель разомкнут, проход не обращается к системе начисления и не возвращает ошибок
+	assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+	assert.Equal(t, 1, provider.calls)
+	assert.Empty(t, db.failures)
+	assert.Equal(t, map[string]int{"1": 2, "2": 2, "3": 2}, db.deferred)
+}
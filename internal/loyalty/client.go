@@ -0,0 +1,180 @@
+package loyalty
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/go-resty/resty/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ClientConfig содержит настройки HTTP-клиента системы начисления.
+type ClientConfig struct {
+	Timeout         time.Duration // Timeout это ограничение времени одного запроса.
+	MaxConnsPerHost int           // MaxConnsPerHost это максимальное количество соединений с системой начисления.
+	MaxIdleConns    int           // MaxIdleConns это количество соединений, которые держатся открытыми между запросами.
+	IdleConnTimeout time.Duration // IdleConnTimeout это время, через которое закрывается неиспользуемое соединение.
+	RetryCount      int           // RetryCount это количество повторов запроса при сетевых ошибках и ответах 5xx.
+	RetryWaitTime   time.Duration // RetryWaitTime это начальная пауза между повторами.
+	RetryMaxWait    time.Duration // RetryMaxWait это максимальная пауза между повторами.
+	UserAgent       string        // UserAgent это значение заголовка User-Agent.
+	OrderPath       string        // OrderPath это шаблон пути запроса информации о заказе с параметром {number}.
+	TLS             *tls.Config   // TLS это настройки TLS соединений, nil означает настройки по умолчанию.
+	AuthToken       string        // AuthToken это статический токен, передаваемый в заголовке Authorization: Bearer.
+	SigningSecret   []byte        // SigningSecret это ключ HMAC-подписи запросов, пустой ключ отключает подпись.
+}
+
+// DefaultClientConfig возвращает настройки HTTP-клиента системы начисления по умолчанию.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		Timeout:         5 * time.Second,
+		MaxConnsPerHost: 32,
+		MaxIdleConns:    32,
+		IdleConnTimeout: 90 * time.Second,
+		RetryCount:      2,
+		RetryWaitTime:   500 * time.Millisecond,
+		RetryMaxWait:    2 * time.Second,
+		UserAgent:       "gophermart",
+		OrderPath:       "/api/orders/{number}",
+	}
+}
+
+// GetOrderInfo запрашивает у системы начисления информацию о заказе.
+func (c *AccrualClient) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	// Выполняем запрос к системе для получения информации о заказе
+	orderFromSystem, err := c.client.R().SetContext(ctx).SetPathParam("number", orderID).Get(c.orderPath)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("error while requesting for order %q: %w", orderID, ctx.Err())
+		}
+		// Сетевая ошибка или тайм-аут означают, что система начисления недоступна
+		return nil, fmt.Errorf("%w: error while requesting for order %q: %w", errors2.ErrAccrualUnavailable, orderID, err)
+	}
+	switch code := orderFromSystem.StatusCode(); {
+	case code == http.StatusOK:
+	case code == http.StatusNoContent:
+		// Заказ не зарегистрирован в системе расчёта
+		return nil, errors2.ErrOrderNotRegistered
+	case code == http.StatusTooManyRequests:
+		// Система начисления просит приостановить запросы
+		return nil, errors2.ErrTooManyRequests{RetryAfter: parseRetryAfter(orderFromSystem.Header().Get("Retry-After"))}
+	case code >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: status %d", errors2.ErrAccrualUnavailable, code)
+	default:
+		return nil, fmt.Errorf("unexpected status %d from accrual system for order %q", code, orderID)
+	}
+	var response accrualResponse
+	// Декодируем тело ответа системы начисления
+	if err = json.Unmarshal(orderFromSystem.Body(), &response); err != nil {
+		return nil, fmt.Errorf("error while unmarshalling order body: %w", err)
+	}
+	if err = response.validate(orderID); err != nil {
+		return nil, err
+	}
+	// Переводим статус системы начисления в статус заказа
+	status, _ := response.Status.ToOrderStatus()
+	info := &models.OrderInfo{
+		OrderID: orderID,
+		Order:   &orderID,
+		Status:  status,
+	}
+	if response.Accrual != nil {
+		info.Accrual = *response.Accrual
+	}
+	return info, nil
+}
+
+// validate проверяет, что ответ относится к запрошенному заказу orderID, статус известен,
+// а начисление присутствует только у статуса PROCESSED и не отрицательно.
+func (r *accrualResponse) validate(orderID string) error {
+	if r.Order != orderID {
+		return fmt.Errorf("%w: answer for order %q to request for order %q", errors2.ErrInvalidResponse, r.Order, orderID)
+	}
+	if _, ok := r.Status.ToOrderStatus(); !ok {
+		return fmt.Errorf("%w: unknown accrual status %q for order %q", errors2.ErrInvalidResponse, r.Status, orderID)
+	}
+	if r.Accrual == nil {
+		return nil
+	}
+	if r.Status != models.AccrualStatusProcessed {
+		return fmt.Errorf("%w: accrual for order %q in status %s", errors2.ErrInvalidResponse, orderID, r.Status)
+	}
+	if *r.Accrual < 0 {
+		return fmt.Errorf("%w: negative accrual %s for order %q", errors2.ErrInvalidResponse, *r.Accrual, orderID)
+	}
+	return nil
+}
+
+// SignRequest вычисляет HMAC-SHA256 подпись запроса к системе начисления по ключу secret.
+// Подписывается строка из метода, пути с параметрами и отметки времени, разделённых переводом строки.
+func SignRequest(secret []byte, method, uri, timestamp string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp))
+	return mac.Sum(nil)
+}
+
+// NewAccrualClient создает долгоживущий клиент системы начисления по адресу addr.
+func NewAccrualClient(addr string, cfg ClientConfig) *AccrualClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	if cfg.TLS != nil {
+		transport.TLSClientConfig = cfg.TLS
+	}
+
+	client := resty.New().
+		SetTransport(transport).
+		SetBaseURL(addr).
+		SetTimeout(cfg.Timeout).
+		SetHeader("User-Agent", cfg.UserAgent).
+		SetRetryCount(cfg.RetryCount).
+		SetRetryWaitTime(cfg.RetryWaitTime).
+		SetRetryMaxWaitTime(cfg.RetryMaxWait).
+		// Повторяем запрос только при сетевых ошибках и ответах 5xx; ответ 429 обрабатывается паузой всех запросов.
+		AddRetryCondition(func(r *resty.Response, err error) bool {
+			return err != nil || r.StatusCode() >= http.StatusInternalServerError
+		})
+	if cfg.AuthToken != "" {
+		client.SetAuthToken(cfg.AuthToken)
+	}
+	if len(cfg.SigningSecret) > 0 {
+		// Подписываем каждую попытку запроса, включая повторы, со своей отметкой времени
+		secret := cfg.SigningSecret
+		client.SetPreRequestHook(func(_ *resty.Client, r *http.Request) error {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			r.Header.Set(TimestampHeader, timestamp)
+			r.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(SignRequest(secret, r.Method, r.URL.RequestURI(), timestamp)))
+			return nil
+		})
+	}
+	return &AccrualClient{client: client, orderPath: cfg.OrderPath}
+}
+
+const (
+	SignatureHeader = "X-Signature" // SignatureHeader это заголовок с HMAC-подписью запроса в виде sha256=<hex>.
+	TimestampHeader = "X-Timestamp" // TimestampHeader это заголовок с отметкой времени подписи в секундах Unix.
+)
+
+// AccrualClient реализует AccrualProvider для системы начисления с протоколом Практикума.
+// Он владеет одним HTTP-клиентом с пулом соединений для всех запросов к системе начисления.
+type AccrualClient struct {
+	client    *resty.Client
+	orderPath string
+}
+
+// accrualResponse представляет ответ системы начисления на запрос о заказе.
+type accrualResponse struct {
+	Order   string               `json:"order"`   // Order это номер заказа.
+	Status  models.AccrualStatus `json:"status"`  // Status это статус расчёта начисления.
+	Accrual *models.Money        `json:"accrual"` // Accrual это рассчитанные баллы к начислению, есть только у статуса PROCESSED.
+}
@@ -0,0 +1,156 @@
+package loyalty
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/pem"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAccrualClient_GetOrderInfo(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  int
+		body    string
+		header  map[string]string
+		result  *models.OrderInfo
+		wantErr error
+	}{
+		{
+			name:   "processed",
+			status: http.StatusOK,
+			body:   `{"order":"100500","status":"PROCESSED","accrual":500}`,
+			result: &models.OrderInfo{OrderID: "100500", Status: models.OrderStatusProcessed, Accrual: 50000},
+		},
+		{
+			name:    "answer for another order",
+			status:  http.StatusOK,
+			body:    `{"order":"100501","status":"PROCESSED","accrual":500}`,
+			wantErr: errors2.ErrInvalidResponse,
+		},
+		{
+			name:    "accrual of registered order",
+			status:  http.StatusOK,
+			body:    `{"order":"100500","status":"REGISTERED","accrual":0}`,
+			wantErr: errors2.ErrInvalidResponse,
+		},
+		{
+			name:    "not registered",
+			status:  http.StatusNoContent,
+			wantErr: errors2.ErrOrderNotRegistered,
+		},
+		{
+			name:    "too many requests",
+			status:  http.StatusTooManyRequests,
+			header:  map[string]string{"Retry-After": "30"},
+			wantErr: errors2.ErrTooManyRequests{RetryAfter: 30 * time.Second},
+		},
+		{
+			name:    "unavailable",
+			status:  http.StatusServiceUnavailable,
+			wantErr: errors2.ErrAccrualUnavailable,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var userAgent string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			cfg := DefaultClientConfig()
+			cfg.RetryCount = 0
+			info, err := NewAccrualClient(srv.URL, cfg).GetOrderInfo(context.Background(), "100500")
+			assert.Equal(t, cfg.UserAgent, userAgent)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result.OrderID, info.OrderID)
+			assert.Equal(t, tc.result.Status, info.Status)
+			assert.Equal(t, tc.result.Accrual, info.Accrual)
+		})
+	}
+}
+
+func TestAccrualClient_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	cfg := DefaultClientConfig()
+	cfg.Timeout = 50 * time.Millisecond
+	cfg.RetryCount = 0
+	_, err := NewAccrualClient(srv.URL, cfg).GetOrderInfo(context.Background(), "100500")
+	assert.Error(t, err)
+}
+
+func TestAccrualClient_Auth(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":500}`))
+	}))
+	defer srv.Close()
+
+	cfg := DefaultClientConfig()
+	cfg.RetryCount = 0
+	cfg.AuthToken = "token"
+	cfg.SigningSecret = []byte("secret")
+	_, err := NewAccrualClient(srv.URL, cfg).GetOrderInfo(context.Background(), "100500")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	signature := SignRequest(cfg.SigningSecret, http.MethodGet, "/api/orders/100500", header.Get(TimestampHeader))
+	assert.Equal(t, "sha256="+hex.EncodeToString(signature), header.Get(SignatureHeader))
+}
+
+func TestAccrualClient_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":500}`))
+	}))
+	defer srv.Close()
+
+	cfg := DefaultClientConfig()
+	cfg.RetryCount = 0
+	// Сертификат тестового сервера не подписан доверенным удостоверяющим центром
+	_, err := NewAccrualClient(srv.URL, cfg).GetOrderInfo(context.Background(), "100500")
+	assert.ErrorIs(t, err, errors2.ErrAccrualUnavailable)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	assert.NoError(t, err)
+	cfg.TLS, err = NewTLSConfig(caFile, "", "")
+	assert.NoError(t, err)
+	_, err = NewAccrualClient(srv.URL, cfg).GetOrderInfo(context.Background(), "100500")
+	assert.NoError(t, err)
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cfg, err := NewTLSConfig("", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = NewTLSConfig("", "client.pem", "")
+	assert.Error(t, err)
+
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	assert.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+	_, err = NewTLSConfig(emptyFile, "", "")
+	assert.Error(t, err)
+}
@@ -1,65 +1,248 @@
 package loyalty
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
 	"github.com/ZnNr/Go-GopherMart.git/internal/models"
-	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // UpdateOrdersInfo обновляет информацию о заказах в системе лояльности.
-func (ls *LoyaltySystemManager) UpdateOrdersInfo() error {
-	// Получаем все заказы из базы данных
-	allOrders, err := ls.db.GetAllOrders()
+// Заказы обрабатываются пулом воркеров; ошибка по одному заказу не прерывает обработку остальных,
+// все такие ошибки возвращаются вместе в конце прохода.
+func (ls *LoyaltySystemManager) UpdateOrdersInfo(ctx context.Context) error {
+	// Захватываем в базе данных пачку незавершённых заказов, которые пора опросить
+	orders, err := ls.db.ClaimDueOrders(claimBatchSize, claimLease)
 	if err != nil {
-		return fmt.Errorf("error while getting all orders from db for updating info: %w", err)
+		return fmt.Errorf("error while claiming due orders from db for updating info: %w", err)
 	}
-	// Обновляем информацию по каждому заказу
-	for _, o := range allOrders {
-		actualInfo, err := ls.getActualInfo(o)
-		if err != nil {
-			return fmt.Errorf("error while getting actual info for order %q: %w", o, err)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+	jobs := make(chan string)
+	// Запускаем воркеры, которые запрашивают и сохраняют информацию по заказам
+	for i := 0; i < ls.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for orderID := range jobs {
+				if err := ls.processOrder(ctx, orderID); err != nil {
+					mu.Lock()
+					failed = append(failed, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	// Раздаём заказы воркерам, пока контекст не отменён
+feed:
+	for _, o := range orders {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- o:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(failed...)
+}
+
+// processOrder обновляет один заказ. Если заказ после опроса остался незавершённым, его следующий опрос откладывается;
+// ошибки опроса заказа учитываются, и после quarantineAfter ошибок подряд или первого ответа, нарушающего протокол,
+// заказ помещается в карантин. Недоступность системы начисления ошибкой заказа не считается: его опрос только откладывается.
+func (ls *LoyaltySystemManager) processOrder(ctx context.Context, orderID string) error {
+	final, err := ls.updateOrderInfo(ctx, orderID)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if errors.Is(err, errors2.ErrAccrualUnavailable) || errors.Is(err, errors2.ErrCircuitOpen) {
+		if deferErr := ls.db.DeferPoll(orderID, err.Error()); deferErr != nil {
+			return errors.Join(err, fmt.Errorf("error while deferring poll: %w", deferErr))
 		}
-		// Обновляем информацию о заказе в базе данных
-		if err = ls.db.UpdateOrderInfo(actualInfo); err != nil {
-			return fmt.Errorf("error while updating order info: %w", err)
+		if errors.Is(err, errors2.ErrCircuitOpen) {
+			// Система начисления недоступна, заказ будет опрошен после восстановления
+			ls.log.Debugf("skipping order %q: %s", orderID, err.Error())
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		// Учитываем ошибку опроса; заказ, который раз за разом не удаётся обработать, уходит в карантин.
+		// Ответ, нарушающий протокол, сразу отправляет заказ в карантин.
+		quarantineAfter := ls.quarantineAfter
+		if errors.Is(err, errors2.ErrInvalidResponse) {
+			ls.violations.Add(1)
+			quarantineAfter = 1
+		}
+		quarantined, recordErr := ls.db.RecordPollFailure(orderID, err.Error(), quarantineAfter)
+		if recordErr != nil {
+			return errors.Join(err, fmt.Errorf("error while recording poll failure: %w", recordErr))
+		}
+		if quarantined {
+			ls.log.Warnf("order %q is quarantined: %s", orderID, err.Error())
+		}
+		return err
+	}
+	if !final {
+		if err = ls.db.ScheduleNextPoll(orderID); err != nil {
+			return fmt.Errorf("error while scheduling next poll: %w", err)
 		}
-		ls.log.Infof("order %q updated with accrual: %f", *actualInfo.Order, actualInfo.Accrual)
 	}
 	return nil
 }
 
-// getActualInfo получает актуальную информацию о заказе.
-func (ls *LoyaltySystemManager) getActualInfo(orderID string) (*models.OrderInfo, error) {
-	// Выполняем запрос к системе для получения информации о заказе
-	orderFromSystem, err := resty.New().R().Get(fmt.Sprintf("%s/api/orders/%s", ls.addr, orderID))
+// updateOrderInfo запрашивает актуальную информацию по одному заказу и сохраняет её в базе данных.
+// Возвращает true, если заказ перешёл в окончательный статус.
+func (ls *LoyaltySystemManager) updateOrderInfo(ctx context.Context, orderID string) (bool, error) {
+	actualInfo, err := ls.GetOrderInfo(ctx, orderID)
+	if errors.Is(err, errors2.ErrOrderNotRegistered) {
+		// Система начисления ещё не знает о заказе, спросим о нём позже
+		ls.log.Debugf("order %q is not registered in accrual system yet", orderID)
+		return false, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error while requesting for order %q: %w", orderID, err)
+		return false, fmt.Errorf("error while getting actual info for order %q: %w", orderID, err)
+	}
+	if err = models.ValidateOrderInfo(orderID, actualInfo); err != nil {
+		return false, err
 	}
-	var info models.OrderInfo
-	// Декодируем тело ответа в структуру OrderInfo
-	if err = json.Unmarshal(orderFromSystem.Body(), &info); err != nil {
-		return nil, fmt.Errorf("error while unmarshalling order body: %w", err)
+	// Обновляем информацию о заказе в базе данных
+	if err = ls.db.UpdateOrderInfo(actualInfo); err != nil {
+		if errors.Is(err, errors2.ErrForbiddenTransition) {
+			// Заказ уже в окончательном статусе, запоздавший ответ системы начисления не применяем
+			ls.log.Warnf("rejected status update of order %q: %s", orderID, err.Error())
+			return true, nil
+		}
+		return false, fmt.Errorf("error while updating order info: %w", err)
 	}
-	return &info, nil
+	ls.log.Infof("order %q updated with accrual: %s", *actualInfo.Order, actualInfo.Accrual)
+	return actualInfo.Status.IsFinal(), nil
+}
+
+// Violations возвращает количество ответов системы начисления, нарушивших протокол.
+func (ls *LoyaltySystemManager) Violations() int64 {
+	return ls.violations.Load()
 }
 
-func New(addr string, db DBManager, logger *zap.SugaredLogger) *LoyaltySystemManager {
-	return &LoyaltySystemManager{
-		addr: addr,
-		db:   db,
-		log:  logger,
+// PausedUntil возвращает момент, до которого запросы к системе начисления приостановлены.
+func (ls *LoyaltySystemManager) PausedUntil() time.Time {
+	return ls.throttle.pausedUntil()
+}
+
+// acquire дожидается окончания паузы и своей очереди в общем бюджете запросов к системе начисления.
+func (ls *LoyaltySystemManager) acquire(ctx context.Context) error {
+	resumed, err := ls.throttle.wait(ctx)
+	if err != nil {
+		return err
 	}
+	if resumed {
+		ls.log.Infof("resuming requests to accrual system after pause")
+	}
+	return nil
 }
 
+// GetOrderInfo запрашивает информацию о заказе в пределах общего бюджета запросов к системе начисления:
+// дожидается окончания паузы и своей очереди, а после ответа 429 приостанавливает все запросы и повторяет запрос.
+// Через него к системе начисления обращаются и опрос заказов, и сверка начислений.
+func (ls *LoyaltySystemManager) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	for {
+		if err := ls.acquire(ctx); err != nil {
+			return nil, err
+		}
+		info, err := ls.provider.GetOrderInfo(ctx, orderID)
+		var tooMany errors2.ErrTooManyRequests
+		if !errors.As(err, &tooMany) {
+			return info, err
+		}
+		// Приостанавливаем все запросы и повторяем тот же заказ после паузы
+		until := ls.throttle.pause(tooMany.RetryAfter)
+		ls.log.Warnf("accrual system rate limit exceeded, pausing requests until %s", until.Format(time.RFC3339))
+	}
+}
+
+// New создает менеджер системы лояльности; по умолчанию заказы обрабатываются одним воркером без ограничения частоты запросов.
+func New(provider AccrualProvider, db DBManager, logger *zap.SugaredLogger, opts ...Option) *LoyaltySystemManager {
+	ls := &LoyaltySystemManager{
+		provider:        provider,
+		db:              db,
+		log:             logger,
+		workers:         1,
+		throttle:        newThrottle(0),
+		quarantineAfter: defaultQuarantineAfter,
+	}
+	for _, opt := range opts {
+		opt(ls)
+	}
+	return ls
+}
+
+// Option определяет функцию для настройки LoyaltySystemManager.
+type Option func(ls *LoyaltySystemManager)
+
+// WithWorkers задаёт количество воркеров, параллельно опрашивающих систему начисления.
+func WithWorkers(workers int) Option {
+	return func(ls *LoyaltySystemManager) {
+		if workers > 0 {
+			ls.workers = workers
+		}
+	}
+}
+
+// WithRateLimit ограничивает общее для всех воркеров количество запросов к системе начисления в секунду.
+func WithRateLimit(rps int) Option {
+	return func(ls *LoyaltySystemManager) {
+		ls.throttle = newThrottle(rps)
+	}
+}
+
+// WithQuarantineAfter задаёт количество ошибок опроса заказа подряд, после которого заказ помещается в карантин.
+func WithQuarantineAfter(failures int) Option {
+	return func(ls *LoyaltySystemManager) {
+		if failures > 0 {
+			ls.quarantineAfter = failures
+		}
+	}
+}
+
+const (
+	defaultQuarantineAfter = 10              // defaultQuarantineAfter это количество ошибок опроса заказа подряд до карантина по умолчанию.
+	claimBatchSize         = 100             // claimBatchSize это максимальное количество заказов, захватываемых за один проход.
+	claimLease             = 2 * time.Minute // claimLease это время, в течение которого захваченные заказы не выдаются другим экземплярам.
+)
+
 type LoyaltySystemManager struct {
-	addr string
-	db   DBManager
-	log  *zap.SugaredLogger
+	provider AccrualProvider
+	db       DBManager
+	log      *zap.SugaredLogger
+	workers  int
+	throttle *throttle
+	// quarantineAfter это количество ошибок опроса заказа подряд, после которого заказ помещается в карантин.
+	quarantineAfter int
+	// violations это количество ответов системы начисления, нарушивших протокол.
+	violations atomic.Int64
 }
 
 type DBManager interface {
-	GetAllOrders() ([]string, error)
+	ClaimDueOrders(limit int, lease time.Duration) ([]string, error)
+	ScheduleNextPoll(orderID string) error
+	RecordPollFailure(orderID string, reason string, quarantineAfter int) (bool, error)
+	DeferPoll(orderID string, reason string) error
 	UpdateOrderInfo(orderInfo *models.OrderInfo) error
 }
+
+// AccrualProvider получает у системы начисления информацию о заказе.
+// Реализации переводят протокол конкретной системы начисления в models.OrderInfo.
+type AccrualProvider interface {
+	GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error)
+}
@@ -0,0 +1,413 @@
+package loyalty
+
+import (
+	"context"
+	"github.com/ZnNr/Go-GopherMart.git/internal/accrualstub"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDBManager хранит заказы в памяти и запоминает обновления.
+type fakeDBManager struct {
+	mu        sync.Mutex
+	orders    []string
+	updated   map[string]*models.OrderInfo
+	scheduled map[string]int
+	final     map[string]bool
+	failures  map[string]int
+	deferred  map[string]int
+}
+
+func newFakeDBManager(orders ...string) *fakeDBManager {
+	return &fakeDBManager{
+		orders:    orders,
+		updated:   make(map[string]*models.OrderInfo),
+		scheduled: make(map[string]int),
+		final:     make(map[string]bool),
+		failures:  make(map[string]int),
+		deferred:  make(map[string]int),
+	}
+}
+
+func (f *fakeDBManager) ClaimDueOrders(limit int, lease time.Duration) ([]string, error) {
+	return f.orders, nil
+}
+
+func (f *fakeDBManager) ScheduleNextPoll(orderID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scheduled[orderID]++
+	return nil
+}
+
+func (f *fakeDBManager) RecordPollFailure(orderID string, reason string, quarantineAfter int) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[orderID]++
+	return f.failures[orderID] >= quarantineAfter, nil
+}
+
+func (f *fakeDBManager) DeferPoll(orderID string, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deferred[orderID]++
+	return nil
+}
+
+func (f *fakeDBManager) UpdateOrderInfo(orderInfo *models.OrderInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.final[*orderInfo.Order] {
+		return errors2.ErrForbiddenTransition
+	}
+	f.updated[*orderInfo.Order] = orderInfo
+	return nil
+}
+
+// newTestManager создает менеджер системы лояльности, опрашивающий систему начисления по адресу url.
+func newTestManager(url string, db DBManager, opts ...Option) *LoyaltySystemManager {
+	cfg := DefaultClientConfig()
+	cfg.RetryWaitTime = 10 * time.Millisecond
+	cfg.RetryMaxWait = 50 * time.Millisecond
+	return New(NewAccrualClient(url, cfg), db, zap.NewNop().Sugar(), opts...)
+}
+
+func TestLoyaltySystemManager_UpdateOrdersInfo(t *testing.T) {
+	t.Run("positive", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":500}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500")
+		ls := newTestManager(srv.URL, db)
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Equal(t, models.OrderStatusProcessed, db.updated["100500"].Status)
+		assert.Equal(t, models.Money(50000), db.updated["100500"].Accrual)
+		assert.Empty(t, db.scheduled)
+	})
+	t.Run("late response for final order is rejected", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"PROCESSING"}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500")
+		db.final["100500"] = true
+		ls := newTestManager(srv.URL, db)
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Empty(t, db.updated)
+		assert.Empty(t, db.scheduled)
+	})
+	t.Run("unknown accrual status", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"DONE"}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500")
+		ls := newTestManager(srv.URL, db)
+		assert.ErrorContains(t, ls.UpdateOrdersInfo(context.Background()), `unknown accrual status "DONE"`)
+		assert.Empty(t, db.updated)
+	})
+	t.Run("not registered order is skipped", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/orders/100500" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100501","status":"INVALID"}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500", "100501")
+		ls := newTestManager(srv.URL, db)
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Len(t, db.updated, 1)
+		assert.Equal(t, models.OrderStatusInvalid, db.updated["100501"].Status)
+		assert.Equal(t, map[string]int{"100500": 1}, db.scheduled)
+	})
+	t.Run("server error is retried", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100500","status":"PROCESSED","accrual":10}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500")
+		ls := newTestManager(srv.URL, db)
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Equal(t, int32(2), calls.Load())
+		assert.Len(t, db.updated, 1)
+	})
+	t.Run("failed order does not stop the others", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/orders/100500" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"100501","status":"PROCESSED","accrual":10}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500", "100501")
+		ls := newTestManager(srv.URL, db)
+		err := ls.UpdateOrdersInfo(context.Background())
+		assert.ErrorIs(t, err, errors2.ErrAccrualUnavailable)
+		assert.Len(t, db.updated, 1)
+		assert.Contains(t, db.updated, "100501")
+		// Недоступность системы начисления откладывает опрос заказа, но не считается его ошибкой
+		assert.Empty(t, db.failures)
+		assert.Equal(t, map[string]int{"100500": 1}, db.deferred)
+		assert.Empty(t, db.scheduled)
+	})
+	t.Run("order is quarantined after repeated failures", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		logger, logs := observer.New(zap.WarnLevel)
+		db := newFakeDBManager("100500")
+		ls := New(NewAccrualClient(srv.URL, DefaultClientConfig()), db, zap.New(logger).Sugar(), WithQuarantineAfter(2))
+		assert.Error(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Equal(t, 0, logs.FilterMessageSnippet("quarantined").Len())
+		assert.Error(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Equal(t, 1, logs.FilterMessageSnippet("quarantined").Len())
+		assert.Equal(t, 2, db.failures["100500"])
+	})
+	t.Run("invalid responses quarantine the order at once", func(t *testing.T) {
+		responses := map[string]string{
+			"/api/orders/100500": `{"order":"100501","status":"PROCESSED","accrual":10}`,
+			"/api/orders/100501": `{"order":"100501","status":"PROCESSED","accrual":-10}`,
+			"/api/orders/100502": `{"order":"100502","status":"PROCESSING","accrual":10}`,
+		}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(responses[r.URL.Path]))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500", "100501", "100502")
+		ls := newTestManager(srv.URL, db, WithQuarantineAfter(5))
+		assert.ErrorIs(t, ls.UpdateOrdersInfo(context.Background()), errors2.ErrInvalidResponse)
+		assert.Empty(t, db.updated)
+		assert.Equal(t, map[string]int{"100500": 1, "100501": 1, "100502": 1}, db.failures)
+		assert.Equal(t, int64(3), ls.Violations())
+	})
+	t.Run("too many requests: pause and resume", func(t *testing.T) {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 2 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte("No more than N requests per minute allowed"))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"` + r.URL.Path[len("/api/orders/"):] + `","status":"PROCESSING"}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500", "100501")
+		ls := newTestManager(srv.URL, db)
+		start := time.Now()
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(3), calls.Load())
+		assert.Len(t, db.updated, 2)
+		assert.Equal(t, map[string]int{"100500": 1, "100501": 1}, db.scheduled)
+		assert.False(t, ls.PausedUntil().IsZero())
+	})
+	t.Run("too many requests: context cancelled during pause", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("100500")
+		ls := newTestManager(srv.URL, db)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, ls.UpdateOrdersInfo(ctx), context.DeadlineExceeded)
+		assert.Empty(t, db.updated)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), ls.PausedUntil(), 5*time.Second)
+	})
+}
+
+func TestLoyaltySystemManager_UpdateOrdersInfoWorkers(t *testing.T) {
+	t.Run("orders are polled concurrently", func(t *testing.T) {
+		var inFlight, maxInFlight atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"` + r.URL.Path[len("/api/orders/"):] + `","status":"PROCESSED","accrual":1}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("1", "2", "3", "4", "5", "6", "7", "8")
+		ls := newTestManager(srv.URL, db, WithWorkers(4))
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Len(t, db.updated, 8)
+		assert.Greater(t, maxInFlight.Load(), int32(1))
+		assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+	})
+	t.Run("workers share rate limit", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"` + r.URL.Path[len("/api/orders/"):] + `","status":"PROCESSED","accrual":1}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("1", "2", "3", "4", "5")
+		ls := newTestManager(srv.URL, db, WithWorkers(5), WithRateLimit(20))
+		start := time.Now()
+		assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+		assert.Len(t, db.updated, 5)
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	})
+	t.Run("context cancellation stops workers", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"` + r.URL.Path[len("/api/orders/"):] + `","status":"PROCESSED","accrual":1}`))
+		}))
+		defer srv.Close()
+
+		db := newFakeDBManager("1", "2", "3", "4", "5")
+		ls := newTestManager(srv.URL, db, WithWorkers(2), WithRateLimit(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, ls.UpdateOrdersInfo(ctx), context.DeadlineExceeded)
+		assert.Less(t, len(db.updated), 5)
+	})
+}
+
+// fakeAccrualProvider отвечает заранее заданной информацией о заказах без обращения к сети.
+type fakeAccrualProvider map[string]models.OrderStatus
+
+func (f fakeAccrualProvider) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	status, ok := f[orderID]
+	if !ok {
+		return nil, errors2.ErrOrderNotRegistered
+	}
+	return &models.OrderInfo{OrderID: orderID, Order: &orderID, Status: status}, nil
+}
+
+func TestLoyaltySystemManager_GetOrderInfo(t *testing.T) {
+	// Сверка и другие потребители получают информацию о заказе с теми же паузами по ответу 429, что и опрос
+	provider := &tooManyRequestsProvider{AccrualProvider: fakeAccrualProvider{"1": models.OrderStatusProcessed}, left: 1}
+	ls := New(provider, newFakeDBManager(), zap.NewNop().Sugar())
+	start := time.Now()
+	info, err := ls.GetOrderInfo(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusProcessed, info.Status)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.False(t, ls.PausedUntil().IsZero())
+	assert.Equal(t, 2, provider.calls)
+}
+
+// tooManyRequestsProvider отвечает ErrTooManyRequests на первые left запросов, а затем передаёт их AccrualProvider.
+type tooManyRequestsProvider struct {
+	AccrualProvider
+	left  int
+	calls int
+}
+
+func (p *tooManyRequestsProvider) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	p.calls++
+	if p.left > 0 {
+		p.left--
+		return nil, errors2.ErrTooManyRequests{RetryAfter: 100 * time.Millisecond}
+	}
+	return p.AccrualProvider.GetOrderInfo(ctx, orderID)
+}
+
+func TestLoyaltySystemManager_UpdateOrdersInfoWithFakeClient(t *testing.T) {
+	db := newFakeDBManager("1", "2")
+	ls := New(fakeAccrualProvider{"1": models.OrderStatusProcessed}, db, zap.NewNop().Sugar())
+	assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+	assert.Equal(t, models.OrderStatusProcessed, db.updated["1"].Status)
+	assert.Equal(t, map[string]int{"2": 1}, db.scheduled)
+}
+
+func TestLoyaltySystemManager_UpdateOrdersInfoWithStub(t *testing.T) {
+	stub := accrualstub.New()
+	stub.Script("1", accrualstub.Registered())
+	stub.Script("2", accrualstub.NotRegistered())
+	stub.Script("3", accrualstub.ServerError(), accrualstub.Processed(20.5))
+	stub.Script("4", accrualstub.TooManyRequests(time.Second), accrualstub.Invalid())
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	db := newFakeDBManager("1", "2", "3", "4")
+	ls := newTestManager(srv.URL, db, WithWorkers(2))
+	assert.NoError(t, ls.UpdateOrdersInfo(context.Background()))
+	assert.Equal(t, models.OrderStatusProcessing, db.updated["1"].Status)
+	assert.NotContains(t, db.updated, "2")
+	assert.Equal(t, models.Money(2050), db.updated["3"].Accrual)
+	assert.Equal(t, models.OrderStatusInvalid, db.updated["4"].Status)
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, db.scheduled)
+	assert.Equal(t, 2, stub.Requests("4"))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		value  string
+		result time.Duration
+	}{
+		{
+			name:   "seconds",
+			value:  "60",
+			result: time.Minute,
+		},
+		{
+			name:   "empty",
+			value:  "",
+			result: defaultRetryAfter,
+		},
+		{
+			name:   "garbage",
+			value:  "soon",
+			result: defaultRetryAfter,
+		},
+		{
+			name:   "date in the past",
+			value:  "Wed, 21 Oct 2015 07:28:00 GMT",
+			result: 0,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.result, parseRetryAfter(tt.value))
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package loyalty
+
+import (
+	"fmt"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"go.uber.org/zap"
+)
+
+// NewProviders создает по настройкам params реестр систем начисления: систему по умолчанию и системы партнёров.
+// Все системы используют общие настройки клиента, и каждая защищена своим автоматическим выключателем;
+// выключатели возвращаются по именам систем, чтобы отдавать их состояние.
+func NewProviders(params *models.Config, log *zap.SugaredLogger) (*Registry, map[string]*CircuitBreaker, error) {
+	clientConfig := DefaultClientConfig()
+	clientConfig.Timeout = params.AccrualSystem.Timeout
+	clientConfig.RetryCount = params.AccrualSystem.Retries
+	clientConfig.AuthToken = params.AccrualSystem.AuthToken
+	clientConfig.SigningSecret = []byte(params.AccrualSystem.SigningSecret)
+	tlsConfig, err := NewTLSConfig(params.AccrualSystem.CAFile, params.AccrualSystem.CertFile, params.AccrualSystem.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while init accrual system TLS: %w", err)
+	}
+	clientConfig.TLS = tlsConfig
+	breakerConfig := DefaultBreakerConfig()
+	if params.AccrualSystem.BreakerFailures > 0 {
+		breakerConfig.FailureThreshold = params.AccrualSystem.BreakerFailures
+	}
+	if params.AccrualSystem.BreakerTimeout > 0 {
+		breakerConfig.OpenTimeout = params.AccrualSystem.BreakerTimeout
+	}
+	breakers := make(map[string]*CircuitBreaker)
+	newProvider := func(name, addr string) AccrualProvider {
+		breakers[name] = NewCircuitBreaker(name, NewAccrualClient(addr, clientConfig), breakerConfig, log)
+		return breakers[name]
+	}
+	var defaultProvider AccrualProvider
+	if params.AccrualSystem.Address != "" {
+		defaultProvider = newProvider("default", params.AccrualSystem.Address)
+	}
+	registry := NewRegistry(defaultProvider)
+	partners, err := ParseProviders(params.AccrualSystem.Providers)
+	if err != nil {
+		return nil, nil, err
+	}
+	for prefix, addr := range partners {
+		registry.Register(prefix, newProvider("prefix "+prefix, addr))
+	}
+	return registry, breakers, nil
+}
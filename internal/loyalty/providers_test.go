@@ -0,0 +1,43 @@
+package loyalty
+
+import (
+	"context"
+	"github.com/ZnNr/Go-GopherMart.git/internal/accrualstub"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewProviders(t *testing.T) {
+	defaultStub := accrualstub.New()
+	defaultStub.Script("100", accrualstub.Processed(10))
+	defaultSrv := httptest.NewServer(defaultStub)
+	defer defaultSrv.Close()
+	partnerStub := accrualstub.New()
+	partnerStub.Script("900", accrualstub.Invalid())
+	partnerSrv := httptest.NewServer(partnerStub)
+	defer partnerSrv.Close()
+
+	params := &models.Config{}
+	params.AccrualSystem.Address = defaultSrv.URL
+	params.AccrualSystem.Providers = "9=" + partnerSrv.URL
+	registry, breakers, err := NewProviders(params, zap.NewNop().Sugar())
+	require.NoError(t, err)
+	assert.Len(t, breakers, 2)
+	assert.Contains(t, breakers, "default")
+	assert.Contains(t, breakers, "prefix 9")
+
+	info, err := registry.GetOrderInfo(context.Background(), "100")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusProcessed, info.Status)
+	info, err = registry.GetOrderInfo(context.Background(), "900")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusInvalid, info.Status)
+
+	params.AccrualSystem.Providers = "9"
+	_, _, err = NewProviders(params, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
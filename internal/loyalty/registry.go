@@ -0,0 +1,80 @@
+package loyalty
+
+import (
+	"context"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"sort"
+	"strings"
+)
+
+// GetOrderInfo запрашивает информацию о заказе у системы начисления, к которой он относится.
+func (r *Registry) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	provider, err := r.Provider(orderID)
+	if err != nil {
+		return nil, err
+	}
+	return provider.GetOrderInfo(ctx, orderID)
+}
+
+// Provider возвращает систему начисления для заказа: с самым длинным подходящим префиксом номера,
+// а если такой нет — систему по умолчанию.
+func (r *Registry) Provider(orderID string) (AccrualProvider, error) {
+	for _, rt := range r.routes {
+		if strings.HasPrefix(orderID, rt.prefix) {
+			return rt.provider, nil
+		}
+	}
+	if r.fallback == nil {
+		return nil, fmt.Errorf("%w %q", errors2.ErrNoAccrualProvider, orderID)
+	}
+	return r.fallback, nil
+}
+
+// Register направляет в provider заказы, номер которых начинается с prefix.
+// Регистрация выполняется при настройке приложения, до начала опроса.
+func (r *Registry) Register(prefix string, provider AccrualProvider) {
+	r.routes = append(r.routes, route{prefix: prefix, provider: provider})
+	sort.SliceStable(r.routes, func(i, j int) bool {
+		return len(r.routes[i].prefix) > len(r.routes[j].prefix)
+	})
+}
+
+// NewRegistry создает реестр систем начисления; fallback обслуживает заказы без подходящего префикса и может быть nil.
+func NewRegistry(fallback AccrualProvider) *Registry {
+	return &Registry{fallback: fallback}
+}
+
+// ParseProviders разбирает описание систем начисления партнёров вида "prefix=address,prefix=address".
+func ParseProviders(spec string) (map[string]string, error) {
+	providers := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		prefix, addr, ok := strings.Cut(item, "=")
+		prefix, addr = strings.TrimSpace(prefix), strings.TrimSpace(addr)
+		if !ok || prefix == "" || addr == "" {
+			return nil, fmt.Errorf("error while parsing accrual provider %q: expected prefix=address", item)
+		}
+		if _, exists := providers[prefix]; exists {
+			return nil, fmt.Errorf("error while parsing accrual provider %q: duplicate prefix", item)
+		}
+		providers[prefix] = addr
+	}
+	return providers, nil
+}
+
+// Registry выбирает систему начисления для заказа по префиксу его номера и сам реализует AccrualProvider.
+type Registry struct {
+	fallback AccrualProvider
+	routes   []route // routes упорядочены по убыванию длины префикса.
+}
+
+// route связывает префикс номера заказа с системой начисления.
+type route struct {
+	prefix   string
+	provider AccrualProvider
+}
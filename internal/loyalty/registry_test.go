@@ -0,0 +1,92 @@
+package loyalty
+
+import (
+	"context"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRegistry_GetOrderInfo(t *testing.T) {
+	registry := NewRegistry(fakeAccrualProvider{"100": models.OrderStatusProcessed, "900": models.OrderStatusProcessed})
+	registry.Register("9", fakeAccrualProvider{"900": models.OrderStatusInvalid, "990": models.OrderStatusInvalid})
+	registry.Register("99", fakeAccrualProvider{"990": models.OrderStatusProcessing})
+
+	testCases := []struct {
+		name    string
+		orderID string
+		status  models.OrderStatus
+	}{
+		{
+			name:    "fallback",
+			orderID: "100",
+			status:  models.OrderStatusProcessed,
+		},
+		{
+			name:    "prefix",
+			orderID: "900",
+			status:  models.OrderStatusInvalid,
+		},
+		{
+			name:    "longest prefix",
+			orderID: "990",
+			status:  models.OrderStatusProcessing,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := registry.GetOrderInfo(context.Background(), tc.orderID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, info.Status)
+		})
+	}
+}
+
+func TestRegistry_NoProvider(t *testing.T) {
+	registry := NewRegistry(nil)
+	registry.Register("9", fakeAccrualProvider{})
+	_, err := registry.GetOrderInfo(context.Background(), "100")
+	assert.ErrorIs(t, err, errors2.ErrNoAccrualProvider)
+}
+
+func TestParseProviders(t *testing.T) {
+	testCases := []struct {
+		name    string
+		spec    string
+		result  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			spec:   "",
+			result: map[string]string{},
+		},
+		{
+			name:   "several providers",
+			spec:   "9=http://partner:8080, 77=http://other:8080",
+			result: map[string]string{"9": "http://partner:8080", "77": "http://other:8080"},
+		},
+		{
+			name:    "missing address",
+			spec:    "9=",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate prefix",
+			spec:    "9=http://a,9=http://b",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			providers, err := ParseProviders(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, providers)
+		})
+	}
+}
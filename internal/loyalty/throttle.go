@@ -0,0 +1,110 @@
+package loyalty
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRetryAfter используется, если система начисления не прислала корректный заголовок Retry-After.
+const defaultRetryAfter = 60 * time.Second
+
+// throttle задаёт общий для всех воркеров бюджет запросов к системе начисления:
+// ограничивает частоту запросов и приостанавливает их все по ответу 429.
+type throttle struct {
+	mu       sync.Mutex
+	interval time.Duration // interval это минимальный промежуток между запросами, 0 — без ограничения.
+	next     time.Time     // next это момент, начиная с которого можно выполнить следующий запрос.
+	until    time.Time     // until это момент окончания паузы.
+	resumed  bool          // resumed показывает, что окончание текущей паузы уже было замечено.
+}
+
+// newThrottle создает throttle с ограничением rps запросов в секунду; rps <= 0 отключает ограничение.
+func newThrottle(rps int) *throttle {
+	t := &throttle{resumed: true}
+	if rps > 0 {
+		t.interval = time.Second / time.Duration(rps)
+	}
+	return t
+}
+
+// pause откладывает запросы на время d и возвращает момент возобновления.
+// Уже действующая более длинная пауза не сокращается.
+func (t *throttle) pause(d time.Duration) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until := time.Now().Add(d); until.After(t.until) {
+		t.until = until
+		t.resumed = false
+	}
+	return t.until
+}
+
+// pausedUntil возвращает момент, до которого запросы приостановлены.
+func (t *throttle) pausedUntil() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.until
+}
+
+// wait блокируется до окончания паузы и своей очереди в бюджете запросов или до отмены контекста.
+// Возвращает true ровно одному из ожидающих после окончания очередной паузы.
+func (t *throttle) wait(ctx context.Context) (bool, error) {
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		if now.Before(t.until) {
+			d := t.until.Sub(now)
+			t.mu.Unlock()
+			if err := sleep(ctx, d); err != nil {
+				return false, err
+			}
+			continue
+		}
+		resumed := !t.resumed
+		t.resumed = true
+		slot := now
+		if slot.Before(t.next) {
+			slot = t.next
+		}
+		t.next = slot.Add(t.interval)
+		t.mu.Unlock()
+		if err := sleep(ctx, slot.Sub(now)); err != nil {
+			return false, err
+		}
+		return resumed, nil
+	}
+}
+
+// sleep ожидает d или отмены контекста.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// parseRetryAfter разбирает значение заголовка Retry-After в секундах или в формате HTTP-даты.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
@@ -0,0 +1,262 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"go.uber.org/zap"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Up применяет все ещё не применённые миграции по возрастанию версии и возвращает количество применённых.
+// Каждая миграция выполняется в своей транзакции вместе с записью о ней в schema_migrations.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err = m.apply(ctx, conn, migration.Up, `insert into schema_migrations (version, name) values ($1, $2)`, migration.Version, migration.Name); err != nil {
+			return count, fmt.Errorf("error while applying migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		m.log.Infof("applied migration %d %s", migration.Version, migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Down откатывает steps последних применённых миграций и возвращает количество откаченных.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err = m.apply(ctx, conn, migration.Down, `delete from schema_migrations where version = $1`, migration.Version); err != nil {
+			return count, fmt.Errorf("error while reverting migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		m.log.Infof("reverted migration %d %s", migration.Version, migration.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Status возвращает все известные миграции с отметкой о времени их применения.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.unlock(conn)
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Latest возвращает версию последней встроенной миграции.
+func Latest() int {
+	migrations, err := load(files)
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// apply выполняет скрипт миграции и изменение записи о ней в schema_migrations в одной транзакции.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, script string, recordQuery string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, recordQuery, args...); err != nil {
+		return fmt.Errorf("error while recording migration: %w", err)
+	}
+	return tx.Commit()
+}
+
+// applied создаёт таблицу schema_migrations, если её нет, и возвращает время применения каждой применённой версии.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	createQuery := `create table if not exists schema_migrations (version bigint primary key, name text not null, applied_at timestamp with time zone not null default now())`
+	if _, err := conn.ExecContext(ctx, createQuery); err != nil {
+		return nil, fmt.Errorf("error while trying to create table with schema migrations: %w", err)
+	}
+	rows, err := conn.QueryContext(ctx, `select version, applied_at from schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error while selecting applied migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error while scanning applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while selecting applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// lock захватывает advisory-блокировку миграций, дожидаясь, пока её отпустит другой экземпляр.
+// Блокировка принадлежит сессии, поэтому все запросы миграции выполняются на возвращённом соединении.
+func (m *Migrator) lock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting connection for migrations: %w", err)
+	}
+	if _, err = conn.ExecContext(ctx, `select pg_advisory_lock($1)`, LockKey); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error while trying to acquire migrations lock: %w", err)
+	}
+	return conn, nil
+}
+
+// unlock снимает блокировку миграций и возвращает соединение в пул.
+func (m *Migrator) unlock(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `select pg_advisory_unlock($1)`, LockKey); err != nil {
+		m.log.Errorf("error while releasing migrations lock: %s", err.Error())
+	}
+	conn.Close()
+}
+
+// load читает пары файлов NNNN_name.up.sql и NNNN_name.down.sql и возвращает миграции по возрастанию версии.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error while listing migrations: %w", err)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base := path.Base(entry)
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("error while loading migration %q: expected name.up.sql or name.down.sql", base)
+		}
+		prefix, title, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("error while loading migration %q: version must be a positive number", base)
+		}
+		script, err := fs.ReadFile(fsys, entry)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading migration %q: %w", base, err)
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if migration.Name != title {
+			return nil, fmt.Errorf("error while loading migration %q: version %d is already used by %s", base, version, migration.Name)
+		}
+		if direction == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("error while loading migration %d %s: both up and down scripts are required", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// New создает Migrator для встроенных в сервис миграций схемы базы данных.
+func New(db *sql.DB, log *zap.SugaredLogger) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		log:        log,
+		migrations: migrations,
+	}, nil
+}
+
+const (
+	// LockKey это ключ advisory-блокировки, под которой экземпляры сервиса применяют миграции по очереди.
+	LockKey       int64 = 0x676f706865726d69
+	unlockTimeout       = 5 * time.Second // unlockTimeout это время на снятие блокировки миграций.
+)
+
+// Migration представляет одну версию схемы базы данных.
+type Migration struct {
+	Version int    // Version это номер версии схемы.
+	Name    string // Name это краткое описание миграции.
+	Up      string // Up это скрипт перехода на версию.
+	Down    string // Down это скрипт отката версии.
+}
+
+// Status представляет состояние миграции в базе данных.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // AppliedAt это время применения, nil у неприменённой миграции.
+}
+
+// Migrator применяет и откатывает миграции схемы базы данных.
+type Migrator struct {
+	db         *sql.DB
+	log        *zap.SugaredLogger
+	migrations []Migration
+}
@@ -0,0 +1,163 @@
+package migrations
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("embedded migrations", func(t *testing.T) {
+		migrations, err := load(files)
+		assert.NoError(t, err)
+		for i, migration := range migrations {
+			assert.Equal(t, i+1, migration.Version)
+			assert.NotEmpty(t, migration.Up)
+			assert.NotEmpty(t, migration.Down)
+		}
+		assert.Equal(t, len(migrations), Latest())
+	})
+
+	testCases := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"sql/0010_b.up.sql":   {Data: []byte("b")},
+				"sql/0010_b.down.sql": {Data: []byte("b")},
+				"sql/0002_a.up.sql":   {Data: []byte("a")},
+				"sql/0002_a.down.sql": {Data: []byte("a")},
+			},
+			want: []int{2, 10},
+		},
+		{
+			name:    "missing down script",
+			fsys:    fstest.MapFS{"sql/0001_a.up.sql": {Data: []byte("a")}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate version",
+			fsys: fstest.MapFS{
+				"sql/0001_a.up.sql":   {Data: []byte("a")},
+				"sql/0001_a.down.sql": {Data: []byte("a")},
+				"sql/0001_b.up.sql":   {Data: []byte("b")},
+				"sql/0001_b.down.sql": {Data: []byte("b")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "bad name",
+			fsys:    fstest.MapFS{"sql/init.up.sql": {Data: []byte("a")}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := load(tc.fsys)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			versions := make([]int, 0, len(migrations))
+			for _, migration := range migrations {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tc.want, versions)
+		})
+	}
+}
+
+// newTestMigrator создает Migrator с двумя миграциями поверх sqlmock.
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Migrator{
+		db:  db,
+		log: zap.NewNop().Sugar(),
+		migrations: []Migration{
+			{Version: 1, Name: "init", Up: "create table a (id int)", Down: "drop table a"},
+			{Version: 2, Name: "b", Up: "create table b (id int)", Down: "drop table b"},
+		},
+	}, mock
+}
+
+// expectApplied описывает захват блокировки и чтение применённых версий.
+func expectApplied(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_lock($1)`)).WithArgs(LockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`create table if not exists schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, time.Now())
+	}
+	mock.ExpectQuery(`select version, applied_at from schema_migrations`).WillReturnRows(rows)
+}
+
+func TestMigrator_Up(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectApplied(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`create table b (id int)`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`insert into schema_migrations (version, name) values ($1, $2)`)).WithArgs(2, "b").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(LockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	count, err := migrator.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_UpFailure(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectApplied(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`create table a (id int)`)).WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(LockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	count, err := migrator.Up(context.Background())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, 0, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Down(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectApplied(mock, 1, 2)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`drop table b`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`delete from schema_migrations where version = $1`)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(LockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	count, err := migrator.Down(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Status(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectApplied(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta(`select pg_advisory_unlock($1)`)).WithArgs(LockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	statuses, err := migrator.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,3 @@
+drop table if exists withdraw;
+drop table if exists orders;
+drop table if exists registered_users;
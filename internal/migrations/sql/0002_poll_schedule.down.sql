@@ -0,0 +1,2 @@
+drop index if exists orders_due_idx;
+alter table orders drop column if exists next_poll_at, drop column if exists last_polled_at, drop column if exists poll_attempts;
@@ -0,0 +1,8 @@
+-- Планирование опросов системы начисления.
+alter table orders add column if not exists poll_attempts integer not null default 0, add column if not exists last_polled_at timestamp with time zone, add column if not exists next_poll_at timestamp with time zone not null default now();
+-- Частичный индекс по заказам, которые ещё нужно опрашивать в системе начисления.
+create index if not exists orders_due_idx on orders (next_poll_at) where status in ('NEW', 'PROCESSING', 'REGISTERED');
+-- Статус REGISTERED принадлежит системе начисления, у заказов он заменяется на PROCESSING.
+update orders set status = 'PROCESSING' where status = 'REGISTERED';
+-- Индекс, который заменён orders_due_idx.
+drop index if exists orders_unprocessed_idx;
@@ -0,0 +1,2 @@
+-- Время последнего обратного вызова системы начисления.
+alter table orders add column if not exists callback_at timestamp with time zone;
@@ -0,0 +1 @@
+alter table orders drop column if exists quarantined_at, drop column if exists last_error, drop column if exists poll_failures;
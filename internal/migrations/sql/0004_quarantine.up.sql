@@ -0,0 +1,2 @@
+-- Учёт ошибок опроса и карантин заказов.
+alter table orders add column if not exists poll_failures integer not null default 0, add column if not exists last_error text, add column if not exists quarantined_at timestamp with time zone;
@@ -0,0 +1,2 @@
+drop table if exists accrual_adjustments;
+drop table if exists accrual_discrepancies;
@@ -0,0 +1,4 @@
+-- Расхождения начислений, найденные сверкой с системой начисления.
+create table if not exists accrual_discrepancies (id bigserial primary key, order_id text not null, login text not null, recorded_status text, recorded_accrual double precision, actual_status text, actual_accrual double precision, detected_at timestamp with time zone not null default now(), adjusted_at timestamp with time zone);
+-- Корректировки начислений: расхождения исправляются записями, а не изменением заказов.
+create table if not exists accrual_adjustments (id bigserial primary key, order_id text not null, login text not null, amount double precision not null, discrepancy_id bigint references accrual_discrepancies (id), created_at timestamp with time zone not null default now());
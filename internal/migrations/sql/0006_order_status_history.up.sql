@@ -0,0 +1,7 @@
+-- История статусов заказов.
+create table if not exists order_status_history (id bigserial primary key, order_id text not null references orders (order_id), status text not null, accrual double precision, source text not null, changed_at timestamp with time zone not null default now());
+create index if not exists order_status_history_order_idx on order_status_history (order_id, changed_at);
+-- Заказы, загруженные до появления истории, получают в ней запись о текущем статусе.
+insert into order_status_history (order_id, status, accrual, source, changed_at)
+	select order_id, status, accrual, 'backfill', uploaded_at from orders o
+	where not exists (select 1 from order_status_history h where h.order_id = o.order_id);
@@ -0,0 +1,5 @@
+alter table accrual_adjustments alter column amount type double precision;
+alter table accrual_discrepancies alter column recorded_accrual type double precision, alter column actual_accrual type double precision;
+alter table order_status_history alter column accrual type double precision;
+alter table withdraw alter column amount type double precision;
+alter table orders alter column accrual type double precision;
@@ -0,0 +1,6 @@
+-- Суммы баллов хранятся точно, с двумя знаками после запятой; существующие значения округляются до сотых.
+alter table orders alter column accrual type numeric(20, 2) using round(accrual::numeric, 2);
+alter table withdraw alter column amount type numeric(20, 2) using round(amount::numeric, 2);
+alter table order_status_history alter column accrual type numeric(20, 2) using round(accrual::numeric, 2);
+alter table accrual_discrepancies alter column recorded_accrual type numeric(20, 2) using round(recorded_accrual::numeric, 2), alter column actual_accrual type numeric(20, 2) using round(actual_accrual::numeric, 2);
+alter table accrual_adjustments alter column amount type numeric(20, 2) using round(amount::numeric, 2);
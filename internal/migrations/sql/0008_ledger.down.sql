@@ -0,0 +1,2 @@
+drop table if exists ledger_entries;
+drop table if exists ledger_transactions;
@@ -0,0 +1,24 @@
+-- Журнал баллов по двойной записи: каждая проводка состоит из записей с противоположными суммами по двум счетам.
+create table ledger_transactions (id bigserial primary key, kind text not null, order_id text not null, created_at timestamp with time zone not null default now());
+create table ledger_entries (id bigserial primary key, transaction_id bigint not null references ledger_transactions (id), account text not null, amount numeric(20, 2) not null);
+create index ledger_entries_account_idx on ledger_entries (account);
+create index ledger_entries_transaction_idx on ledger_entries (transaction_id);
+-- Перенос в журнал начислений, корректировок и списаний, сделанных до его появления.
+do $$
+declare
+	r record;
+	transaction_id bigint;
+begin
+	for r in select order_id, login, accrual, uploaded_at from orders where status = 'PROCESSED' and accrual <> 0 order by uploaded_at loop
+		insert into ledger_transactions (kind, order_id, created_at) values ('accrual', r.order_id, r.uploaded_at) returning id into transaction_id;
+		insert into ledger_entries (transaction_id, account, amount) values (transaction_id, 'system:accruals', -r.accrual), (transaction_id, 'user:' || r.login, r.accrual);
+	end loop;
+	for r in select order_id, login, amount, created_at from accrual_adjustments order by id loop
+		insert into ledger_transactions (kind, order_id, created_at) values ('adjustment', r.order_id, r.created_at) returning id into transaction_id;
+		insert into ledger_entries (transaction_id, account, amount) values (transaction_id, 'system:accruals', -r.amount), (transaction_id, 'user:' || r.login, r.amount);
+	end loop;
+	for r in select order_id, login, amount, processed_at from withdraw order by processed_at loop
+		insert into ledger_transactions (kind, order_id, created_at) values ('withdrawal', r.order_id, r.processed_at) returning id into transaction_id;
+		insert into ledger_entries (transaction_id, account, amount) values (transaction_id, 'user:' || r.login, -r.amount), (transaction_id, 'system:withdrawals', r.amount);
+	end loop;
+end $$;
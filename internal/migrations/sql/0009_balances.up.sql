@@ -0,0 +1,7 @@
+-- Баланс пользователей, обновляемый вместе с каждой проводкой журнала баллов, чтобы читать его одной строкой.
+create table balances (login text primary key, current numeric(20, 2) not null default 0, withdrawn numeric(20, 2) not null default 0, updated_at timestamp with time zone not null default now());
+-- Начальные балансы пересчитываются по журналу баллов.
+insert into balances (login, current, withdrawn)
+	select substr(e.account, length('user:') + 1), sum(e.amount), coalesce(-sum(e.amount) filter (where t.kind = 'withdrawal'), 0)
+	from ledger_entries e join ledger_transactions t on t.id = e.transaction_id
+	where starts_with(e.account, 'user:') group by e.account;
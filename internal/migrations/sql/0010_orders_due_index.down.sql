@@ -0,0 +1,2 @@
+drop index if exists orders_due_idx;
+create index orders_due_idx on orders (next_poll_at) where status in ('NEW', 'PROCESSING', 'REGISTERED');
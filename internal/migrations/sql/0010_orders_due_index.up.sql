@@ -0,0 +1,3 @@
+-- Статус REGISTERED у заказов не встречается (см. 0002), поэтому индекс опрашиваемых заказов пересоздаётся без него.
+drop index if exists orders_due_idx;
+create index orders_due_idx on orders (next_poll_at) where status in ('NEW', 'PROCESSING');
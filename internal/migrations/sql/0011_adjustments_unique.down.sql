@@ -0,0 +1 @@
+drop index if exists accrual_adjustments_discrepancy_idx;
@@ -0,0 +1,9 @@
+-- Каждое расхождение исправляется не больше одного раза. Повторные корректировки, записанные параллельными сверками,
+-- уже проведены по журналу баллов, поэтому не удаляются автоматически, а останавливают миграцию.
+do $$
+begin
+	if exists (select 1 from accrual_adjustments where discrepancy_id is not null group by discrepancy_id having count(*) > 1) then
+		raise exception 'accrual_adjustments has several adjustments of one discrepancy, resolve them before migrating';
+	end if;
+end $$;
+create unique index if not exists accrual_adjustments_discrepancy_idx on accrual_adjustments (discrepancy_id);
@@ -0,0 +1 @@
+drop index if exists accrual_discrepancies_open_idx;
@@ -0,0 +1,6 @@
+-- По заказу хранится не больше одного неисправленного расхождения. Повторы, сохранённые параллельными сверками,
+-- не исправлялись и на начисления не влияли, поэтому остаётся только последнее из них.
+delete from accrual_discrepancies d
+	where d.adjusted_at is null
+	and exists (select 1 from accrual_discrepancies n where n.order_id = d.order_id and n.adjusted_at is null and n.id > d.id);
+create unique index if not exists accrual_discrepancies_open_idx on accrual_discrepancies (order_id) where adjusted_at is null;
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
 	"github.com/golang-jwt/jwt/v4"
 	"time"
 )
@@ -14,6 +16,99 @@ type User struct {
 // OrderStatus представляет состояние заказа.
 type OrderStatus string
 
+const (
+	OrderStatusNew        OrderStatus = "NEW"        // OrderStatusNew заказ загружен в систему, но не попал в обработку.
+	OrderStatusProcessing OrderStatus = "PROCESSING" // OrderStatusProcessing вознаграждение за заказ рассчитывается.
+	OrderStatusInvalid    OrderStatus = "INVALID"    // OrderStatusInvalid система расчёта вознаграждений отказала в расчёте.
+	OrderStatusProcessed  OrderStatus = "PROCESSED"  // OrderStatusProcessed данные по заказу проверены и информация о расчёте успешно получена.
+)
+
+// orderTransitions содержит допустимые переходы между статусами заказа: для каждого статуса — статусы, в которые
+// из него можно перейти. Из окончательных статусов переходов нет.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusProcessing: {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+}
+
+// IsValid сообщает, является ли статус одним из известных статусов заказа.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusNew, OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed:
+		return true
+	}
+	return false
+}
+
+// IsFinal сообщает, является ли статус окончательным, после которого заказ больше не опрашивается.
+func (s OrderStatus) IsFinal() bool {
+	return s == OrderStatusProcessed || s == OrderStatusInvalid
+}
+
+// CanTransitionTo сообщает, допустим ли переход заказа из статуса s в статус to.
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionSources возвращает статусы, из которых допустим переход в статус to.
+func TransitionSources(to OrderStatus) []OrderStatus {
+	sources := make([]OrderStatus, 0, len(orderTransitions))
+	for _, from := range []OrderStatus{OrderStatusNew, OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed} {
+		if from.CanTransitionTo(to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+// ValidateOrderInfo проверяет, что информация от системы начисления относится к заказу orderID,
+// статус заказа известен, а начисление не отрицательно и есть только у обработанного заказа.
+func ValidateOrderInfo(orderID string, info *OrderInfo) error {
+	if orderID == "" {
+		return fmt.Errorf("%w: answer without order", errors2.ErrInvalidResponse)
+	}
+	if info.Order == nil || *info.Order != orderID || info.OrderID != orderID {
+		return fmt.Errorf("%w: answer for another order to request for order %q", errors2.ErrInvalidResponse, orderID)
+	}
+	if !info.Status.IsValid() {
+		return fmt.Errorf("%w: unknown status %q for order %q", errors2.ErrInvalidResponse, info.Status, orderID)
+	}
+	if info.Accrual < 0 {
+		return fmt.Errorf("%w: negative accrual %s for order %q", errors2.ErrInvalidResponse, info.Accrual, orderID)
+	}
+	if info.Accrual != 0 && info.Status != OrderStatusProcessed {
+		return fmt.Errorf("%w: accrual for order %q in status %s", errors2.ErrInvalidResponse, orderID, info.Status)
+	}
+	return nil
+}
+
+// AccrualStatus представляет статус расчёта начисления в системе начисления.
+type AccrualStatus string
+
+const (
+	AccrualStatusRegistered AccrualStatus = "REGISTERED" // AccrualStatusRegistered заказ зарегистрирован, но начисление не рассчитано.
+	AccrualStatusInvalid    AccrualStatus = "INVALID"    // AccrualStatusInvalid заказ не принят к расчёту.
+	AccrualStatusProcessing AccrualStatus = "PROCESSING" // AccrualStatusProcessing расчёт начисления в процессе.
+	AccrualStatusProcessed  AccrualStatus = "PROCESSED"  // AccrualStatusProcessed расчёт начисления окончен.
+)
+
+// ToOrderStatus сопоставляет статусу системы начисления статус заказа. Возвращает false для неизвестного статуса.
+func (s AccrualStatus) ToOrderStatus() (OrderStatus, bool) {
+	switch s {
+	case AccrualStatusRegistered, AccrualStatusProcessing:
+		return OrderStatusProcessing, true
+	case AccrualStatusInvalid:
+		return OrderStatusInvalid, true
+	case AccrualStatusProcessed:
+		return OrderStatusProcessed, true
+	}
+	return "", false
+}
+
 // OrderInfo содержит информацию о заказе.
 type OrderInfo struct {
 	UserName  *string     `json:"user,omitempty"`        // UserName это имя пользователя, который разместил заказ.
@@ -21,7 +116,41 @@ type OrderInfo struct {
 	Order     *string     `json:"order,omitempty"`       // Order это детали заказа.
 	CreatedAt *time.Time  `json:"uploaded_at,omitempty"` // CreatedAt это временная метка создания заказа.
 	Status    OrderStatus `json:"status"`                // Status это состояние заказа.
-	Accrual   float64     `json:"accrual"`               // Accrual это сумма начисления заказа.
+	Accrual   Money       `json:"accrual"`               // Accrual это сумма начисления заказа.
+}
+
+// OrderStatusChange содержит запись истории статусов заказа.
+type OrderStatusChange struct {
+	Status    OrderStatus `json:"status"`     // Status это статус, в который перешёл заказ.
+	Accrual   Money       `json:"accrual"`    // Accrual это сумма начисления заказа после перехода.
+	ChangedAt time.Time   `json:"changed_at"` // ChangedAt это время перехода.
+}
+
+// QuarantinedOrder содержит информацию о заказе, исключённом из опроса после повторяющихся ошибок.
+type QuarantinedOrder struct {
+	OrderID       string      `json:"number"`         // OrderID это уникальный идентификатор заказа.
+	UserName      string      `json:"user"`           // UserName это имя пользователя, который разместил заказ.
+	Status        OrderStatus `json:"status"`         // Status это состояние заказа.
+	CreatedAt     time.Time   `json:"uploaded_at"`    // CreatedAt это временная метка создания заказа.
+	PollFailures  int         `json:"poll_failures"`  // PollFailures это количество ошибок опроса подряд.
+	LastError     string      `json:"last_error"`     // LastError это текст последней ошибки опроса.
+	QuarantinedAt time.Time   `json:"quarantined_at"` // QuarantinedAt это время помещения заказа в карантин.
+}
+
+// Discrepancy содержит расхождение между начислением по заказу в сервисе и в системе начисления.
+type Discrepancy struct {
+	ID              int64       `json:"id"`               // ID это идентификатор расхождения.
+	OrderID         string      `json:"number"`           // OrderID это уникальный идентификатор заказа.
+	UserName        string      `json:"user"`             // UserName это имя пользователя, который разместил заказ.
+	RecordedStatus  OrderStatus `json:"recorded_status"`  // RecordedStatus это статус заказа в сервисе.
+	RecordedAccrual Money       `json:"recorded_accrual"` // RecordedAccrual это начисление по заказу в сервисе с учётом корректировок.
+	ActualStatus    OrderStatus `json:"actual_status"`    // ActualStatus это статус заказа в системе начисления.
+	ActualAccrual   Money       `json:"actual_accrual"`   // ActualAccrual это начисление по заказу в системе начисления.
+}
+
+// Adjustment возвращает корректировку, которая приводит начисление в сервисе к начислению в системе начисления.
+func (d *Discrepancy) Adjustment() Money {
+	return d.ActualAccrual - d.RecordedAccrual
 }
 
 // WithdrawInfo содержит информацию о списании средств(баллов).
@@ -29,13 +158,21 @@ type WithdrawInfo struct {
 	UserName    *string    `json:"user,omitempty"`         // UserName это имя пользователя.
 	OrderID     string     `json:"order"`                  // OrderID это идентификатор заказа.
 	ProcessedAt *time.Time `json:"processed_at,omitempty"` // ProcessedAt это временная метка обработки заказа.
-	Amount      float64    `json:"sum"`                    // Amount это сумма вывода средств.
+	Amount      Money      `json:"sum"`                    // Amount это сумма вывода средств.
 }
 
 // BalanceInfo содержит информацию о балансе.
 type BalanceInfo struct {
-	Current   float64 `json:"current"`   // Current это текущий баланс.
-	Withdrawn float64 `json:"withdrawn"` // Withdrawn это сумма вывода средств.
+	Current   Money `json:"current"`   // Current это текущий баланс.
+	Withdrawn Money `json:"withdrawn"` // Withdrawn это сумма вывода средств.
+}
+
+// BalanceMismatch содержит расхождение сохранённого баланса пользователя с балансом, пересчитанным по журналу баллов.
+type BalanceMismatch struct {
+	UserName string      `json:"user"`     // UserName это имя пользователя.
+	Stored   BalanceInfo `json:"stored"`   // Stored это баланс из таблицы балансов.
+	Actual   BalanceInfo `json:"actual"`   // Actual это баланс, пересчитанный по журналу баллов.
+	Repaired bool        `json:"repaired"` // Repaired сообщает, исправлен ли сохранённый баланс.
 }
 
 type Claims struct {
@@ -55,12 +192,41 @@ type Option func(params *Config)
 // Config содержит конфигурацию.
 type Config struct {
 	Server struct {
-		Address string
+		Address    string
+		AdminToken string // AdminToken это токен доступа к административным маршрутам, пустой токен отключает их.
+	}
+	Reconcile struct {
+		Interval time.Duration // Interval это период сверки начислений с системой начисления, 0 отключает сверку.
+		Window   time.Duration // Window это глубина сверки: проверяются заказы, загруженные за это время.
+		Apply    bool          // Apply включает корректировку найденных расхождений.
 	}
 	Database struct {
 		ConnectionString string
+		Migrate          bool // Migrate включает применение миграций схемы базы данных при запуске сервиса.
 	}
 	AccrualSystem struct {
-		Address string
+		Address   string
+		Workers   int           // Workers это количество воркеров, параллельно опрашивающих систему начисления.
+		RateLimit int           // RateLimit это ограничение количества запросов к системе начисления в секунду, 0 — без ограничения.
+		Timeout   time.Duration // Timeout это ограничение времени одного запроса к системе начисления.
+		Retries   int           // Retries это количество повторов запроса к системе начисления при сетевых ошибках и ответах 5xx.
+		Providers string        // Providers это системы начисления партнёров в виде "prefix=address,prefix=address".
+		// BreakerFailures это количество отказов системы начисления подряд, после которого запросы к ней приостанавливаются.
+		BreakerFailures int
+		// BreakerTimeout это время, через которое после приостановки выполняется пробный запрос к системе начисления.
+		BreakerTimeout time.Duration
+		// CallbackSecret это общий с системой начисления ключ подписи обратных вызовов, пустой ключ отключает их приём.
+		CallbackSecret string
+		// QuarantineAfter это количество ошибок опроса заказа подряд, после которого заказ помещается в карантин.
+		QuarantineAfter int
+		// CAFile это пакет сертификатов удостоверяющих центров, которым доверяют запросы к системе начисления.
+		CAFile string
+		// CertFile и KeyFile это сертификат и ключ клиента для взаимной аутентификации TLS с системой начисления.
+		CertFile string
+		KeyFile  string
+		// AuthToken это статический токен, передаваемый системе начисления в заголовке Authorization: Bearer.
+		AuthToken string
+		// SigningSecret это ключ HMAC-подписи запросов к системе начисления, пустой ключ отключает подпись.
+		SigningSecret string
 	}
 }
@@ -0,0 +1,109 @@
+package models
+
+import (
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	testCases := []struct {
+		from   OrderStatus
+		to     OrderStatus
+		result bool
+	}{
+		{from: OrderStatusNew, to: OrderStatusProcessing, result: true},
+		{from: OrderStatusNew, to: OrderStatusProcessed, result: true},
+		{from: OrderStatusNew, to: OrderStatusInvalid, result: true},
+		{from: OrderStatusProcessing, to: OrderStatusProcessing, result: true},
+		{from: OrderStatusProcessing, to: OrderStatusProcessed, result: true},
+		{from: OrderStatusProcessing, to: OrderStatusNew, result: false},
+		{from: OrderStatusProcessed, to: OrderStatusProcessing, result: false},
+		{from: OrderStatusProcessed, to: OrderStatusInvalid, result: false},
+		{from: OrderStatusInvalid, to: OrderStatusProcessed, result: false},
+	}
+	for _, tt := range testCases {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.result, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	assert.Equal(t, []OrderStatus{OrderStatusNew, OrderStatusProcessing}, TransitionSources(OrderStatusProcessed))
+	assert.Empty(t, TransitionSources(OrderStatusNew))
+}
+
+func TestAccrualStatus_ToOrderStatus(t *testing.T) {
+	testCases := []struct {
+		accrual AccrualStatus
+		status  OrderStatus
+		ok      bool
+	}{
+		{accrual: AccrualStatusRegistered, status: OrderStatusProcessing, ok: true},
+		{accrual: AccrualStatusProcessing, status: OrderStatusProcessing, ok: true},
+		{accrual: AccrualStatusInvalid, status: OrderStatusInvalid, ok: true},
+		{accrual: AccrualStatusProcessed, status: OrderStatusProcessed, ok: true},
+		{accrual: "UNKNOWN", ok: false},
+	}
+	for _, tt := range testCases {
+		t.Run(string(tt.accrual), func(t *testing.T) {
+			status, ok := tt.accrual.ToOrderStatus()
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.status, status)
+		})
+	}
+}
+
+func TestValidateOrderInfo(t *testing.T) {
+	order, other := "100500", "100501"
+	testCases := []struct {
+		name    string
+		info    OrderInfo
+		wantErr bool
+	}{
+		{
+			name: "processed",
+			info: OrderInfo{OrderID: order, Order: &order, Status: OrderStatusProcessed, Accrual: 10},
+		},
+		{
+			name: "processing without accrual",
+			info: OrderInfo{OrderID: order, Order: &order, Status: OrderStatusProcessing},
+		},
+		{
+			name:    "no order",
+			info:    OrderInfo{Status: OrderStatusProcessed},
+			wantErr: true,
+		},
+		{
+			name:    "another order",
+			info:    OrderInfo{OrderID: other, Order: &other, Status: OrderStatusProcessed},
+			wantErr: true,
+		},
+		{
+			name:    "unknown status",
+			info:    OrderInfo{OrderID: order, Order: &order, Status: "REGISTERED"},
+			wantErr: true,
+		},
+		{
+			name:    "negative accrual",
+			info:    OrderInfo{OrderID: order, Order: &order, Status: OrderStatusProcessed, Accrual: -1},
+			wantErr: true,
+		},
+		{
+			name:    "accrual of invalid order",
+			info:    OrderInfo{OrderID: order, Order: &order, Status: OrderStatusInvalid, Accrual: 1},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateOrderInfo(order, &tc.info)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, errors2.ErrInvalidResponse)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Money представляет сумму баллов в сотых долях, чтобы суммы складывались и сравнивались без погрешности.
+// В JSON сумма записывается числом с двумя знаками после запятой, в базе данных хранится как numeric(20, 2).
+type Money int64
+
+// ParseMoney разбирает десятичную запись суммы, например "729.98" или "1e3".
+// Сумма с большим числом знаков после запятой округляется до сотых долей по банковскому правилу (половина к чётному),
+// так что "0.005" разбирается как 0.00, а "0.015" как 0.02.
+func ParseMoney(s string) (Money, error) {
+	value, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("error while parsing money %q: not a number", s)
+	}
+	value.Mul(value, big.NewRat(moneyScale, 1))
+	units := roundHalfEven(value)
+	if !units.IsInt64() {
+		return 0, fmt.Errorf("error while parsing money %q: out of range", s)
+	}
+	return Money(units.Int64()), nil
+}
+
+// roundHalfEven округляет value до целого, половину округляя к чётному.
+func roundHalfEven(value *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	// Сравниваем удвоенный остаток со знаменателем, чтобы понять, дальше ли value от quotient, чем половина.
+	switch new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) {
+	case 1:
+		quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+	case 0:
+		if quotient.Bit(0) == 1 {
+			quotient.Add(quotient, big.NewInt(int64(remainder.Sign())))
+		}
+	}
+	return quotient
+}
+
+// String возвращает сумму с двумя знаками после запятой.
+func (m Money) String() string {
+	sign := ""
+	units := uint64(m)
+	if m < 0 {
+		sign = "-"
+		units = uint64(-m)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/moneyScale, units%moneyScale)
+}
+
+// MarshalJSON записывает сумму числом с двумя знаками после запятой.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON читает сумму из числа JSON без промежуточного перевода в float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) == 0 || strings.Trim(string(data), "0123456789.-+eE") != "" {
+		return fmt.Errorf("error while parsing money %s: not a number", data)
+	}
+	money, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+// Scan читает сумму из колонки numeric; NULL читается как нулевая сумма.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case int64:
+		*m = Money(v * moneyScale)
+		return nil
+	case string:
+		money, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = money
+		return nil
+	case []byte:
+		return m.Scan(string(v))
+	}
+	return fmt.Errorf("error while scanning money: unsupported type %T", src)
+}
+
+// Value записывает сумму в базу данных десятичной строкой.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// moneyScale это количество сотых долей в одном балле.
+const moneyScale = 100
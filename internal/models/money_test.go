@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	testCases := []struct {
+		input   string
+		result  Money
+		wantErr bool
+	}{
+		{input: "729.98", result: 72998},
+		{input: "500", result: 50000},
+		{input: "0.1", result: 10},
+		{input: "-20.5", result: -2050},
+		{input: "1e3", result: 100000},
+		{input: "0.001", result: 0},
+		{input: "0.005", result: 0},
+		{input: "0.015", result: 2},
+		{input: "0.0051", result: 1},
+		{input: "729.985", result: 72998},
+		{input: "729.995", result: 73000},
+		{input: "-0.015", result: -2},
+		{input: "-0.025", result: -2},
+		{input: "-0.026", result: -3},
+		{input: "abc", wantErr: true},
+		{input: "1e30", wantErr: true},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			money, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.result, money)
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	// Суммы складываются без погрешности, в отличие от 0.1 + 0.2 в float64
+	var balance BalanceInfo
+	assert.NoError(t, json.Unmarshal([]byte(`{"current": 0.1, "withdrawn": 0.2}`), &balance))
+	assert.Equal(t, Money(30), balance.Current+balance.Withdrawn)
+
+	result, err := json.Marshal(BalanceInfo{Current: 50050, Withdrawn: -5})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"current":500.50,"withdrawn":-0.05}`, string(result))
+
+	var info WithdrawInfo
+	assert.Error(t, json.Unmarshal([]byte(`{"order": "1", "sum": "100"}`), &info))
+	assert.NoError(t, json.Unmarshal([]byte(`{"order": "1", "sum": 0.125}`), &info))
+	assert.Equal(t, Money(12), info.Amount)
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var money Money
+	assert.NoError(t, money.Scan("100.50"))
+	assert.Equal(t, Money(10050), money)
+	assert.NoError(t, money.Scan(nil))
+	assert.Equal(t, Money(0), money)
+	assert.NoError(t, money.Scan(int64(3)))
+	assert.Equal(t, Money(300), money)
+	assert.Error(t, money.Scan(0.5))
+
+	value, err := Money(10050).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "100.50", value)
+}
@@ -0,0 +1,157 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/loyalty"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Report содержит итоги сверки.
+type Report struct {
+	From          time.Time `json:"from"`          // From это начало интервала сверки.
+	To            time.Time `json:"to"`            // To это конец интервала сверки.
+	Checked       int       `json:"checked"`       // Checked это количество проверенных заказов.
+	Discrepancies int       `json:"discrepancies"` // Discrepancies это количество найденных расхождений.
+	Adjusted      int       `json:"adjusted"`      // Adjusted это количество исправленных расхождений.
+	Failed        int       `json:"failed"`        // Failed это количество заказов, которые не удалось проверить.
+}
+
+// Pass сверяет заказы, загруженные за последнее окно сверки; предназначен для периодического запуска.
+func (r *Reconciler) Pass(ctx context.Context) error {
+	to := time.Now()
+	report, err := r.Reconcile(ctx, to.Add(-r.window), to)
+	if report != nil {
+		r.log.Infof("accrual reconciliation: checked %d, discrepancies %d, adjusted %d, failed %d",
+			report.Checked, report.Discrepancies, report.Adjusted, report.Failed)
+	}
+	return err
+}
+
+// Reconcile повторно запрашивает у системы начисления обработанные заказы, загруженные в интервале [from, to),
+// и сохраняет расхождения с начислениями в сервисе. Если включена корректировка, расхождения по заказам,
+// которые система начисления считает завершёнными, исправляются корректирующими записями.
+// Ошибка по одному заказу не прерывает сверку остальных, все такие ошибки возвращаются вместе.
+func (r *Reconciler) Reconcile(ctx context.Context, from time.Time, to time.Time) (*Report, error) {
+	orders, err := r.db.GetProcessedOrders(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting processed orders for reconciliation: %w", err)
+	}
+	report := &Report{From: from, To: to}
+	var failed []error
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		if err = r.reconcileOrder(ctx, order, report); err != nil {
+			report.Failed++
+			failed = append(failed, err)
+		}
+	}
+	return report, errors.Join(failed...)
+}
+
+// reconcileOrder сверяет один заказ и учитывает результат в отчёте.
+func (r *Reconciler) reconcileOrder(ctx context.Context, order models.OrderInfo, report *Report) error {
+	actual, err := r.provider.GetOrderInfo(ctx, order.OrderID)
+	if err != nil && !errors.Is(err, errors2.ErrOrderNotRegistered) {
+		return fmt.Errorf("error while getting actual info for order %q: %w", order.OrderID, err)
+	}
+	report.Checked++
+	discrepancy := &models.Discrepancy{
+		OrderID:         order.OrderID,
+		UserName:        *order.UserName,
+		RecordedStatus:  order.Status,
+		RecordedAccrual: order.Accrual,
+	}
+	// Незарегистрированный в системе начисления заказ не должен был получить начисление
+	if actual != nil {
+		discrepancy.ActualStatus = actual.Status
+		discrepancy.ActualAccrual = actual.Accrual
+	}
+	if discrepancy.ActualStatus == discrepancy.RecordedStatus && discrepancy.Adjustment() == 0 {
+		return nil
+	}
+	// Расхождение, уже найденное прошлыми сверками и ещё не исправленное, повторно не сохраняется
+	recorded, err := r.db.RecordDiscrepancy(discrepancy)
+	if err != nil {
+		return err
+	}
+	report.Discrepancies++
+	if recorded {
+		r.log.Warnf("accrual discrepancy for order %q: recorded %q %s, actual %q %s",
+			order.OrderID, discrepancy.RecordedStatus, discrepancy.RecordedAccrual, discrepancy.ActualStatus, discrepancy.ActualAccrual)
+	}
+	// Корректируем только окончательный результат системы начисления и только если разница в сумме
+	if !r.apply || !discrepancy.ActualStatus.IsFinal() || discrepancy.Adjustment() == 0 {
+		return nil
+	}
+	applied, err := r.db.ApplyAdjustment(discrepancy)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		// Расхождение уже исправила параллельная сверка
+		r.log.Debugf("discrepancy of order %q is already adjusted", order.OrderID)
+		return nil
+	}
+	report.Adjusted++
+	r.log.Infof("accrual of order %q adjusted by %s", order.OrderID, discrepancy.Adjustment())
+	return nil
+}
+
+// New создает Reconciler, сверяющий начисления с системой начисления provider.
+// По умолчанию расхождения только сохраняются, а окно периодической сверки равно суткам.
+func New(provider loyalty.AccrualProvider, db DBManager, log *zap.SugaredLogger, opts ...Option) *Reconciler {
+	r := &Reconciler{
+		provider: provider,
+		db:       db,
+		log:      log,
+		window:   defaultWindow,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Option определяет функцию для настройки Reconciler.
+type Option func(r *Reconciler)
+
+// WithApply включает корректировку найденных расхождений.
+func WithApply(apply bool) Option {
+	return func(r *Reconciler) {
+		r.apply = apply
+	}
+}
+
+// WithWindow задаёт глубину периодической сверки.
+func WithWindow(window time.Duration) Option {
+	return func(r *Reconciler) {
+		if window > 0 {
+			r.window = window
+		}
+	}
+}
+
+// defaultWindow это глубина периодической сверки по умолчанию.
+const defaultWindow = 24 * time.Hour
+
+// Reconciler сверяет начисления по обработанным заказам с системой начисления.
+type Reconciler struct {
+	provider loyalty.AccrualProvider
+	db       DBManager
+	log      *zap.SugaredLogger
+	apply    bool
+	window   time.Duration
+}
+
+type DBManager interface {
+	GetProcessedOrders(from time.Time, to time.Time) ([]models.OrderInfo, error)
+	RecordDiscrepancy(d *models.Discrepancy) (bool, error)
+	ApplyAdjustment(d *models.Discrepancy) (bool, error)
+}
@@ -0,0 +1,153 @@
+package reconcile
+
+import (
+	"context"
+	errors2 "github.com/ZnNr/Go-GopherMart.git/internal/errors"
+	"github.com/ZnNr/Go-GopherMart.git/internal/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+// fakeDBManager хранит обработанные заказы в памяти и запоминает расхождения и корректировки.
+type fakeDBManager struct {
+	orders        []models.OrderInfo
+	discrepancies []models.Discrepancy
+	adjusted      map[string]models.Money
+	adjustedIDs   map[int64]bool
+	// concurrent отмечает, что расхождения исправляет параллельная сверка.
+	concurrent bool
+}
+
+func (f *fakeDBManager) GetProcessedOrders(from time.Time, to time.Time) ([]models.OrderInfo, error) {
+	return f.orders, nil
+}
+
+func (f *fakeDBManager) RecordDiscrepancy(d *models.Discrepancy) (bool, error) {
+	for i, existing := range f.discrepancies {
+		if existing.OrderID == d.OrderID && !f.adjustedIDs[existing.ID] {
+			d.ID = existing.ID
+			f.discrepancies[i] = *d
+			return existing.ActualStatus != d.ActualStatus || existing.ActualAccrual != d.ActualAccrual, nil
+		}
+	}
+	d.ID = int64(len(f.discrepancies) + 1)
+	f.discrepancies = append(f.discrepancies, *d)
+	return true, nil
+}
+
+func (f *fakeDBManager) ApplyAdjustment(d *models.Discrepancy) (bool, error) {
+	if f.adjustedIDs[d.ID] || f.concurrent {
+		return false, nil
+	}
+	f.adjusted[d.OrderID] += d.Adjustment()
+	f.adjustedIDs[d.ID] = true
+	return true, nil
+}
+
+// fakeAccrualProvider отвечает заранее заданной информацией о заказах.
+type fakeAccrualProvider map[string]models.OrderInfo
+
+func (f fakeAccrualProvider) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	info, ok := f[orderID]
+	if !ok {
+		return nil, errors2.ErrOrderNotRegistered
+	}
+	return &info, nil
+}
+
+func newProcessedOrder(orderID string, accrual models.Money) models.OrderInfo {
+	login := "test-login"
+	return models.OrderInfo{OrderID: orderID, Order: &orderID, UserName: &login, Status: models.OrderStatusProcessed, Accrual: accrual}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	provider := fakeAccrualProvider{
+		"1": {OrderID: "1", Status: models.OrderStatusProcessed, Accrual: 100},
+		"2": {OrderID: "2", Status: models.OrderStatusProcessed, Accrual: 150},
+		"3": {OrderID: "3", Status: models.OrderStatusInvalid},
+		"4": {OrderID: "4", Status: models.OrderStatusProcessing},
+	}
+	orders := []models.OrderInfo{
+		newProcessedOrder("1", 100),
+		newProcessedOrder("2", 100),
+		newProcessedOrder("3", 50),
+		newProcessedOrder("4", 70),
+		newProcessedOrder("5", 20),
+	}
+	testCases := []struct {
+		name     string
+		apply    bool
+		report   Report
+		adjusted map[string]models.Money
+	}{
+		{
+			name:     "report only",
+			report:   Report{Checked: 5, Discrepancies: 4},
+			adjusted: map[string]models.Money{},
+		},
+		{
+			name:     "apply adjustments",
+			apply:    true,
+			report:   Report{Checked: 5, Discrepancies: 4, Adjusted: 2},
+			adjusted: map[string]models.Money{"2": 50, "3": -50},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &fakeDBManager{orders: orders, adjusted: make(map[string]models.Money), adjustedIDs: make(map[int64]bool)}
+			r := New(provider, db, zap.NewNop().Sugar(), WithApply(tc.apply))
+			report, err := r.Reconcile(context.Background(), time.Time{}, time.Time{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.report, *report)
+			assert.Equal(t, tc.adjusted, db.adjusted)
+			assert.Len(t, db.discrepancies, 4)
+			assert.Equal(t, models.Discrepancy{ID: 4, OrderID: "5", UserName: "test-login", RecordedStatus: models.OrderStatusProcessed, RecordedAccrual: 20}, db.discrepancies[3])
+		})
+	}
+}
+
+func TestReconciler_ReconcileRepeated(t *testing.T) {
+	provider := fakeAccrualProvider{"1": {OrderID: "1", Status: models.OrderStatusProcessed, Accrual: 150}}
+	db := &fakeDBManager{orders: []models.OrderInfo{newProcessedOrder("1", 100)}, adjusted: make(map[string]models.Money), adjustedIDs: make(map[int64]bool)}
+	r := New(provider, db, zap.NewNop().Sugar())
+	for i := 0; i < 3; i++ {
+		report, err := r.Reconcile(context.Background(), time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.Discrepancies)
+	}
+	// Неисправленное расхождение сохраняется один раз, сколько бы сверок его ни нашли
+	assert.Len(t, db.discrepancies, 1)
+}
+
+func TestReconciler_ReconcileAdjustedConcurrently(t *testing.T) {
+	provider := fakeAccrualProvider{"1": {OrderID: "1", Status: models.OrderStatusProcessed, Accrual: 150}}
+	db := &fakeDBManager{orders: []models.OrderInfo{newProcessedOrder("1", 100)}, adjusted: make(map[string]models.Money), adjustedIDs: make(map[int64]bool), concurrent: true}
+	r := New(provider, db, zap.NewNop().Sugar(), WithApply(true))
+	report, err := r.Reconcile(context.Background(), time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	// Расхождение, уже исправленное параллельной сверкой, повторно не исправляется
+	assert.Equal(t, Report{Checked: 1, Discrepancies: 1}, *report)
+	assert.Empty(t, db.adjusted)
+}
+
+func TestReconciler_ReconcileFailedOrder(t *testing.T) {
+	db := &fakeDBManager{orders: []models.OrderInfo{newProcessedOrder("1", 100), newProcessedOrder("2", 100)}, adjusted: make(map[string]models.Money), adjustedIDs: make(map[int64]bool)}
+	provider := failingAccrualProvider{"1": errors2.ErrAccrualUnavailable}
+	r := New(provider, db, zap.NewNop().Sugar())
+	report, err := r.Reconcile(context.Background(), time.Time{}, time.Time{})
+	assert.ErrorIs(t, err, errors2.ErrAccrualUnavailable)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, 1, report.Checked)
+}
+
+// failingAccrualProvider отвечает ошибкой по заданным заказам и начислением 100 по остальным.
+type failingAccrualProvider map[string]error
+
+func (f failingAccrualProvider) GetOrderInfo(ctx context.Context, orderID string) (*models.OrderInfo, error) {
+	if err, ok := f[orderID]; ok {
+		return nil, err
+	}
+	return &models.OrderInfo{OrderID: orderID, Status: models.OrderStatusProcessed, Accrual: 100}, nil
+}
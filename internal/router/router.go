@@ -7,15 +7,60 @@ import (
 	"go.uber.org/zap"
 )
 
+// Option определяет функцию для настройки дополнительных маршрутов.
+type Option func(o *options)
+
+// options содержит настройки дополнительных маршрутов.
+type options struct {
+	status         map[string]func() any
+	callbackSecret []byte
+	adminToken     []byte
+}
+
+// WithStatus добавляет компонент name, состояние которого отдаётся по GET /api/internal/status.
+// Маршрут доступен только по токену администратора, поэтому без WithAdmin не подключается.
+func WithStatus(name string, source func() any) Option {
+	return func(o *options) {
+		if o.status == nil {
+			o.status = make(map[string]func() any)
+		}
+		o.status[name] = source
+	}
+}
+
+// WithAccrualCallback включает приём обратных вызовов системы начисления, подписанных ключом secret.
+func WithAccrualCallback(secret []byte) Option {
+	return func(o *options) {
+		o.callbackSecret = secret
+	}
+}
+
+// WithAdmin включает административные маршруты, доступные по токену token.
+func WithAdmin(token []byte) Option {
+	return func(o *options) {
+		o.adminToken = token
+	}
+}
+
 // POST /api/user/register — регистрация пользователя;
 // POST /api/user/login — аутентификация пользователя;
 // POST /api/user/orders — загрузка пользователем номера заказа для расчёта;
 // GET /api/user/orders — получение списка загруженных пользователем номеров заказов, статусов их обработки и информации о начислениях;
+// GET /api/user/orders/{number}/history — получение истории статусов заказа пользователя;
 // GET /api/user/balance — получение текущего баланса счёта баллов лояльности пользователя;
 // POST /api/user/balance/withdraw — запрос на списание баллов с накопительного счёта в счёт оплаты нового заказа;
-// GET /api/user/withdrawals — получение информации о выводе средств с накопительного счёта пользователем.
+// GET /api/user/withdrawals — получение информации о выводе средств с накопительного счёта пользователем;
+// GET /api/internal/status — получение состояния фоновых компонентов сервиса;
+// POST /api/internal/accrual/callback — приём информации о заказе от системы начисления;
+// GET /api/internal/quarantine — получение заказов в карантине;
+// GET /api/internal/quarantine/{number} — получение заказа в карантине и последней ошибки его опроса;
+// POST /api/internal/quarantine/{number}/requeue — возврат заказа из карантина в опрос.
 // SetupRouter настраивает маршрутизатор для обработки запросов API.
-func SetupRouter(dbManager *database.Manager, log *zap.SugaredLogger) *chi.Mux {
+func SetupRouter(dbManager *database.Manager, log *zap.SugaredLogger, opts ...Option) *chi.Mux {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	handler := handlers.New(dbManager, log)
 	r := chi.NewRouter()
 	// Группа маршрутов для регистрации и входа пользователей.
@@ -29,9 +74,30 @@ func SetupRouter(dbManager *database.Manager, log *zap.SugaredLogger) *chi.Mux {
 		r.Post("/api/user/orders", handler.LoadOrderHandler)
 		r.Post("/api/user/balance/withdraw", handler.WithdrawHandler)
 		r.Get("/api/user/orders", handler.GetOrdersHandler)
+		r.Get("/api/user/orders/{number}/history", handler.GetOrderHistoryHandler)
 		r.Get("/api/user/withdrawals", handler.GetWithdrawalsHandler)
 		r.Get("/api/user/balance", handler.GetBalanceHandler)
 	})
+	// Маршрут для обратных вызовов системы начисления, аутентифицированных подписью.
+	if len(o.callbackSecret) > 0 {
+		callbackHandler := handlers.NewCallback(dbManager, o.callbackSecret, log)
+		r.Post("/api/internal/accrual/callback", callbackHandler.CallbackHandler)
+		WithStatus("accrual_callback_violations", func() any { return callbackHandler.Violations() })(o)
+	}
+	// Группа административных маршрутов, доступных по токену администратора.
+	if len(o.adminToken) > 0 {
+		adminHandler := handlers.NewAdmin(dbManager, o.adminToken, log)
+		r.Group(func(r chi.Router) {
+			r.Use(adminHandler.AuthenticateAdmin)
+			if len(o.status) > 0 {
+				statusHandler := handlers.NewStatus(o.status, log)
+				r.Get("/api/internal/status", statusHandler.StatusHandler)
+			}
+			r.Get("/api/internal/quarantine", adminHandler.GetQuarantinedOrdersHandler)
+			r.Get("/api/internal/quarantine/{number}", adminHandler.GetQuarantinedOrderHandler)
+			r.Post("/api/internal/quarantine/{number}/requeue", adminHandler.RequeueOrderHandler)
+		})
+	}
 
 	return r
 }
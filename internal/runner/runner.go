@@ -2,68 +2,87 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/ZnNr/Go-GopherMart.git/internal/loyalty"
+	"github.com/ZnNr/Go-GopherMart.git/internal/leader"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
-	"time"
 )
 
 type Runner struct {
-	log                 *zap.SugaredLogger
-	server              *http.Server
-	loyaltyPointsSystem *loyalty.LoyaltySystemManager
+	log     *zap.SugaredLogger
+	server  *http.Server
+	elector *leader.Elector
+	jobs    []Job
 }
 
-func New(server *http.Server, loyaltyPointsSystem *loyalty.LoyaltySystemManager, log *zap.SugaredLogger) *Runner {
+// Job это фоновая задача, которая работает до отмены ctx.
+type Job interface {
+	Run(ctx context.Context)
+}
+
+// New создает Runner, который запускает сервер и, на экземпляре-лидере, фоновые задачи jobs.
+func New(server *http.Server, elector *leader.Elector, log *zap.SugaredLogger, jobs ...Job) *Runner {
 	return &Runner{
-		server:              server,
-		log:                 log,
-		loyaltyPointsSystem: loyaltyPointsSystem,
+		server:  server,
+		log:     log,
+		elector: elector,
+		jobs:    jobs,
 	}
 }
 
 func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
-		<-sig
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		}
 		r.log.Infof("Stopping server")
-		if err := r.server.Shutdown(ctx); err != nil {
+		// Останавливаем фоновые задачи, чтобы лидерство перешло к другому экземпляру
+		cancel()
+		if err := r.server.Shutdown(context.Background()); err != nil {
 			r.log.Errorf("Error stopping server: %s", err)
 		}
 	}()
 
-	go r.actualizeOrdersInfo(ctx)
+	// Фоновые задачи выполняются только на экземпляре, ставшем лидером
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.elector.Run(ctx, r.runLeaderJobs)
+	}()
 
 	r.log.Infof("Starting server on addr: %s", r.server.Addr)
-	if err := r.server.ListenAndServe(); err != nil {
+	err := r.server.ListenAndServe()
+	cancel()
+	wg.Wait()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("error while running server: %w", err)
 	}
 	return nil
 }
 
-func (r *Runner) actualizeOrdersInfo(ctx context.Context) {
-	r.log.Infof("Starting actualize orders info")
-	ticker := time.NewTicker(time.Second)
-	errorsCounter := 0
-	for {
-		select {
-		case <-ctx.Done():
-			r.log.Infof("Stopping actualize orders info: context done")
-			return
-		case <-ticker.C:
-			if err := r.loyaltyPointsSystem.UpdateOrdersInfo(); err != nil {
-				r.log.Errorf("error while request to loyalty system: %s", err.Error())
-				errorsCounter++
-				if errorsCounter > 10 {
-					r.log.Infof("Stopping actualize orders because of many errors")
-					return
-				}
-			}
-		}
+// runLeaderJobs запускает фоновые задачи, которые должны выполняться только на одном экземпляре,
+// и дожидается их завершения.
+func (r *Runner) runLeaderJobs(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range r.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			job.Run(ctx)
+		}(job)
 	}
+	wg.Wait()
 }
@@ -0,0 +1,175 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// State представляет состояние периодической задачи под наблюдением Supervisor.
+type State string
+
+const (
+	StateStopped    State = "stopped"     // StateStopped задача не запущена, например экземпляр не является лидером.
+	StateRunning    State = "running"     // StateRunning задача работает, последний проход завершился успешно.
+	StateDegraded   State = "degraded"    // StateDegraded задача работает, но последние проходы завершались ошибками.
+	StateBackingOff State = "backing_off" // StateBackingOff бюджет ошибок исчерпан, задача ждёт перезапуска.
+)
+
+const (
+	defaultErrorBudget = 10              // defaultErrorBudget это допустимое количество ошибок подряд до перезапуска задачи.
+	defaultMinBackoff  = time.Second     // defaultMinBackoff это пауза перед первым перезапуском задачи.
+	defaultMaxBackoff  = 5 * time.Minute // defaultMaxBackoff это максимальная пауза перед перезапуском задачи.
+)
+
+// Status содержит информацию о состоянии периодической задачи.
+type Status struct {
+	State             State      `json:"state"`                     // State это текущее состояние задачи.
+	ConsecutiveErrors int        `json:"consecutive_errors"`        // ConsecutiveErrors это количество ошибок подряд.
+	Restarts          int        `json:"restarts"`                  // Restarts это количество перезапусков задачи.
+	LastError         string     `json:"last_error,omitempty"`      // LastError это текст последней ошибки.
+	LastSuccessAt     *time.Time `json:"last_success_at,omitempty"` // LastSuccessAt это время последнего успешного прохода.
+	BackoffUntil      *time.Time `json:"backoff_until,omitempty"`   // BackoffUntil это время ближайшего перезапуска задачи.
+}
+
+// Run периодически выполняет проход задачи до отмены ctx. Если ошибок подряд становится больше бюджета,
+// задача останавливается и перезапускается после паузы, которая растёт экспоненциально до maxBackoff
+// и сбрасывается после успешного прохода.
+func (s *Supervisor) Run(ctx context.Context) {
+	s.log.Infof("Starting %s", s.name)
+	backoff := s.minBackoff
+	for {
+		err := s.runPasses(ctx, &backoff)
+		if ctx.Err() != nil {
+			s.setState(StateStopped)
+			s.log.Infof("Stopping %s: context done", s.name)
+			return
+		}
+		until := time.Now().Add(backoff)
+		s.mu.Lock()
+		s.status.State = StateBackingOff
+		s.status.BackoffUntil = &until
+		s.mu.Unlock()
+		s.log.Errorf("%s stopped because of many errors, restarting in %s: %s", s.name, backoff, err.Error())
+		select {
+		case <-ctx.Done():
+			s.setState(StateStopped)
+			s.log.Infof("Stopping %s: context done", s.name)
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+		s.mu.Lock()
+		s.status.Restarts++
+		s.status.ConsecutiveErrors = 0
+		s.status.BackoffUntil = nil
+		s.mu.Unlock()
+		s.log.Infof("Restarting %s", s.name)
+	}
+}
+
+// Status возвращает текущее состояние задачи.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Trigger запрашивает внеочередной проход задачи, не дожидаясь таймера.
+// Запросы, поступившие во время прохода, объединяются в один следующий проход.
+func (s *Supervisor) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// runPasses выполняет проходы по таймеру и по запросу Trigger, пока не отменён ctx или не исчерпан бюджет ошибок.
+func (s *Supervisor) runPasses(ctx context.Context, backoff *time.Duration) error {
+	s.setState(StateRunning)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+		err := s.safePass(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.mu.Lock()
+		if err == nil {
+			// Успешный проход восстанавливает бюджет ошибок и сбрасывает паузу перезапуска
+			now := time.Now()
+			s.status.State = StateRunning
+			s.status.ConsecutiveErrors = 0
+			s.status.LastSuccessAt = &now
+			*backoff = s.minBackoff
+			s.mu.Unlock()
+			continue
+		}
+		s.status.State = StateDegraded
+		s.status.ConsecutiveErrors++
+		s.status.LastError = err.Error()
+		exhausted := s.status.ConsecutiveErrors > s.errorBudget
+		s.mu.Unlock()
+		s.log.Errorf("error while running %s: %s", s.name, err.Error())
+		if exhausted {
+			return fmt.Errorf("error budget of %d exhausted: %w", s.errorBudget, err)
+		}
+	}
+}
+
+// safePass выполняет один проход задачи, превращая панику в ошибку.
+func (s *Supervisor) safePass(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in %s: %v", s.name, r)
+		}
+	}()
+	return s.pass(ctx)
+}
+
+// setState устанавливает состояние задачи.
+func (s *Supervisor) setState(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = state
+}
+
+// NewSupervisor создает Supervisor, выполняющий pass каждые interval.
+func NewSupervisor(name string, interval time.Duration, pass func(ctx context.Context) error, log *zap.SugaredLogger) *Supervisor {
+	return &Supervisor{
+		name:        name,
+		interval:    interval,
+		pass:        pass,
+		log:         log,
+		errorBudget: defaultErrorBudget,
+		minBackoff:  defaultMinBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		status:      Status{State: StateStopped},
+		trigger:     make(chan struct{}, 1),
+	}
+}
+
+// Supervisor следит за периодической задачей: считает ошибки, перезапускает её с паузой и сообщает её состояние.
+type Supervisor struct {
+	name        string
+	interval    time.Duration
+	pass        func(ctx context.Context) error
+	log         *zap.SugaredLogger
+	errorBudget int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	trigger     chan struct{} // trigger это запросы внеочередного прохода.
+
+	mu     sync.Mutex
+	status Status
+}
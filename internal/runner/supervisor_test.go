@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestSupervisor создает Supervisor с короткими интервалами для тестов.
+func newTestSupervisor(pass func(ctx context.Context) error) *Supervisor {
+	s := NewSupervisor("test job", 5*time.Millisecond, pass, zap.NewNop().Sugar())
+	s.errorBudget = 2
+	s.minBackoff = 20 * time.Millisecond
+	s.maxBackoff = 40 * time.Millisecond
+	return s
+}
+
+func TestSupervisor_Run(t *testing.T) {
+	t.Run("positive: successful passes", func(t *testing.T) {
+		var passes atomic.Int32
+		s := newTestSupervisor(func(ctx context.Context) error {
+			passes.Add(1)
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx)
+			close(done)
+		}()
+		assert.Eventually(t, func() bool { return passes.Load() >= 3 }, time.Second, time.Millisecond)
+		status := s.Status()
+		assert.Equal(t, StateRunning, status.State)
+		assert.NotNil(t, status.LastSuccessAt)
+		cancel()
+		<-done
+		assert.Equal(t, StateStopped, s.Status().State)
+	})
+	t.Run("errors within budget degrade the job", func(t *testing.T) {
+		var passes atomic.Int32
+		s := newTestSupervisor(func(ctx context.Context) error {
+			if passes.Add(1) == 1 {
+				return errors.New("some error")
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.Run(ctx)
+		assert.Eventually(t, func() bool { return passes.Load() == 2 }, time.Second, time.Millisecond)
+		status := s.Status()
+		assert.Equal(t, StateDegraded, status.State)
+		assert.Equal(t, 1, status.ConsecutiveErrors)
+		assert.Equal(t, "some error", status.LastError)
+	})
+	t.Run("exhausted budget backs off and restarts", func(t *testing.T) {
+		var passes atomic.Int32
+		s := newTestSupervisor(func(ctx context.Context) error {
+			if passes.Add(1) <= 3 {
+				return errors.New("some error")
+			}
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.Run(ctx)
+		assert.Eventually(t, func() bool { return s.Status().State == StateBackingOff }, time.Second, time.Millisecond)
+		assert.NotNil(t, s.Status().BackoffUntil)
+		assert.Eventually(t, func() bool {
+			status := s.Status()
+			return status.State == StateRunning && status.Restarts == 1 && status.ConsecutiveErrors == 0
+		}, time.Second, time.Millisecond)
+	})
+	t.Run("panic is treated as error", func(t *testing.T) {
+		s := newTestSupervisor(func(ctx context.Context) error {
+			panic("boom")
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.Run(ctx)
+		assert.Eventually(t, func() bool { return s.Status().LastError == "panic in test job: boom" }, time.Second, time.Millisecond)
+	})
+}
+
+func TestSupervisor_Trigger(t *testing.T) {
+	var passes atomic.Int32
+	s := NewSupervisor("test job", time.Hour, func(ctx context.Context) error {
+		passes.Add(1)
+		return nil
+	}, zap.NewNop().Sugar())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	// Проходы выполняются по запросу, не дожидаясь часового таймера
+	s.Trigger()
+	assert.Eventually(t, func() bool { return passes.Load() == 1 }, time.Second, time.Millisecond)
+	s.Trigger()
+	assert.Eventually(t, func() bool { return passes.Load() == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}